@@ -1,6 +1,9 @@
 package mysql
 
 import (
+	"sync"
+	"time"
+
 	"github.com/eopenio/itask/v3/backends"
 	"github.com/eopenio/itask/v3/message"
 )
@@ -16,6 +19,9 @@ type Backend struct {
 	idleTime int
 	maxConn  int
 	maxTime  int
+
+	mu          *sync.Mutex
+	lastCleanup time.Time
 }
 
 func NewMySQLBackend(host, port, user, password, db string, idleConn, maxConn, idleTime, maxTime int) Backend {
@@ -34,6 +40,10 @@ func NewMySQLBackend(host, port, user, password, db string, idleConn, maxConn, i
 
 func (c *Backend) Activate() {
 	c.client = NewMySQLClient(c.host, c.port, c.user, c.password, c.db, c.idleConn, c.maxConn, c.idleTime, c.maxTime)
+	if err := c.client.AutoMigrateUnique(); err != nil {
+		panic("Task: init mysql backend error: " + err.Error())
+	}
+	c.mu = &sync.Mutex{}
 }
 
 func (c *Backend) SetPoolSize(n int) {
@@ -54,6 +64,34 @@ func (c *Backend) GetResult(key string) (message.Result, error) {
 	return result, err
 }
 
+func (c *Backend) SetUnique(key string, value string, exTime int) (string, bool, error) {
+	v, ok, err := c.client.SetUnique(key, value, time.Duration(exTime)*time.Second)
+	if err == nil {
+		c.cleanup()
+	}
+	return v, ok, err
+}
+
+func (c *Backend) DelUnique(key string, value string) error {
+	return c.client.DelUnique(key, value)
+}
+
+func (c *Backend) ExpireUnique(key string, value string, exTime int) (bool, error) {
+	return c.client.ExpireUnique(key, value, time.Duration(exTime)*time.Second)
+}
+
+// cleanup 每分钟最多一次，删除过期的去重key
+func (c *Backend) cleanup() {
+	c.mu.Lock()
+	if time.Since(c.lastCleanup) < time.Minute {
+		c.mu.Unlock()
+		return
+	}
+	c.lastCleanup = time.Now()
+	c.mu.Unlock()
+	c.client.DeleteExpiredUnique()
+}
+
 func (c Backend) Clone() backends.BackendInterface {
 	return &Backend{
 		host:     c.host,
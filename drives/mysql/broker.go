@@ -0,0 +1,298 @@
+package mysql
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/eopenio/itask/v3/brokers"
+	"github.com/eopenio/itask/v3/ierrors"
+	"github.com/eopenio/itask/v3/message"
+	"github.com/eopenio/itask/v3/util/yjson"
+	"gorm.io/gorm"
+)
+
+var ErrLeaseLost = errors.New("Task: lease of message is lost")
+
+// Broker
+// MySQL broker based on the table tb_message_queue, require mysql >= 8.0 (SELECT ... FOR UPDATE SKIP LOCKED).
+// Next claims a row with a lease, the row is deleted by Ack,
+// rows claimed but not acked within the visibility timeout are put back by Requeue.
+type Broker struct {
+	client   *Client
+	host     string
+	port     string
+	user     string
+	password string
+	db       string
+	idleConn int
+	idleTime int
+	maxConn  int
+	maxTime  int
+
+	consumer          string
+	visibilityTimeout time.Duration
+	leases            *sync.Map // [delivery]row id
+}
+
+func NewMySQLBroker(host, port, user, password, db string, idleConn, maxConn, idleTime, maxTime int) Broker {
+	return Broker{
+		host:              host,
+		port:              port,
+		user:              user,
+		password:          password,
+		db:                db,
+		idleConn:          idleConn,
+		maxConn:           maxConn,
+		idleTime:          idleTime,
+		maxTime:           maxTime,
+		visibilityTimeout: 5 * time.Minute,
+	}
+}
+
+func (c *Broker) Activate() {
+	c.client = NewMySQLClient(c.host, c.port, c.user, c.password, c.db, c.idleConn, c.maxConn, c.idleTime, c.maxTime)
+	if err := c.client.AutoMigrateQueue(); err != nil {
+		panic("Task: init mysql broker error: " + err.Error())
+	}
+	c.consumer = newConsumerId()
+	c.leases = &sync.Map{}
+}
+
+func (c *Broker) SetPoolSize(n int) {
+}
+
+func (c *Broker) GetPoolSize() int {
+	return 0
+}
+
+func (c *Broker) SetVisibilityTimeout(d time.Duration) {
+	c.visibilityTimeout = d
+}
+
+func (c *Broker) GetVisibilityTimeout() time.Duration {
+	return c.visibilityTimeout
+}
+
+func (c *Broker) Next(queueName string) (message.Message, error) {
+	return c.NextFrom(queueName)
+}
+
+// NextFrom 按顺序检查队列，没有消息时轮询，最多等待2秒
+func (c *Broker) NextFrom(queueNames ...string) (message.Message, error) {
+	end := time.Now().Add(2 * time.Second)
+	for {
+		for _, queueName := range queueNames {
+			row, err := c.client.ClaimQueue(queueName, c.consumer, time.Now().Add(c.visibilityTimeout))
+			if err == nil {
+				return c.decodeRow(row)
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return message.Message{}, err
+			}
+		}
+		if time.Now().After(end) {
+			return message.Message{}, ierrors.ErrEmptyQueue{}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// NextN 领取最多n条消息，不等待
+func (c *Broker) NextN(queueName string, n int) ([]message.Message, error) {
+	rows, err := c.client.ClaimQueueN(queueName, c.consumer, time.Now().Add(c.visibilityTimeout), n)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ierrors.ErrEmptyQueue{}
+		}
+		return nil, err
+	}
+	msgs := make([]message.Message, 0, len(rows))
+	var firstErr error
+	for _, row := range rows {
+		msg, err := c.decodeRow(row)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) == 0 {
+		return nil, firstErr
+	}
+	return msgs, nil
+}
+
+func (c *Broker) decodeRow(row QueueTable) (message.Message, error) {
+	var msg message.Message
+	err := yjson.TaskJson.UnmarshalFromString(row.Payload, &msg)
+	if err != nil {
+		// 无法解析的消息重新投递也没有意义，直接删除
+		c.client.DeleteQueueRow(row.Id, c.consumer)
+		return msg, err
+	}
+	// 行id每次发送都不同，用作delivery
+	msg.Delivery = strconv.FormatInt(row.Id, 10)
+	c.leases.Store(msg.Delivery, row.Id)
+	return msg, nil
+}
+
+func (c *Broker) push(queueName string, msg message.Message, availableAt time.Time, isRight bool) error {
+	b, err := yjson.TaskJson.MarshalToString(msg)
+	if err != nil {
+		return err
+	}
+	return c.client.PushQueue(queueName, msg.Id, b, availableAt, isRight)
+}
+
+func (c *Broker) Send(queueName string, msg message.Message) error {
+	return c.push(queueName, msg, time.Now(), true)
+}
+
+// SendBatch 一条INSERT发送所有消息
+func (c *Broker) SendBatch(queueName string, msgs []message.Message) []error {
+	errs := make([]error, len(msgs))
+	taskIds := make([]string, 0, len(msgs))
+	payloads := make([]string, 0, len(msgs))
+	index := make([]int, 0, len(msgs))
+	for i, msg := range msgs {
+		b, err := yjson.TaskJson.MarshalToString(msg)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		taskIds = append(taskIds, msg.Id)
+		payloads = append(payloads, b)
+		index = append(index, i)
+	}
+	if len(payloads) > 0 {
+		if err := c.client.PushQueueBatch(queueName, taskIds, payloads, time.Now()); err != nil {
+			for _, i := range index {
+				errs[i] = err
+			}
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return errs
+		}
+	}
+	return nil
+}
+
+func (c *Broker) LSend(queueName string, msg message.Message) error {
+	return c.push(queueName, msg, time.Now(), false)
+}
+
+// Schedule 到runAt之后才能被领取
+func (c *Broker) Schedule(queueName string, msg message.Message, runAt time.Time) error {
+	return c.push(queueName, msg, runAt, true)
+}
+
+// MoveDue 延时消息保存在同一个表中，到时间后Next直接就能领取，不需要移动
+func (c *Broker) MoveDue(queueName string, limit int) (int, error) {
+	return 0, nil
+}
+
+func (c *Broker) Ack(queueName string, msg message.Message) error {
+	v, ok := c.leases.LoadAndDelete(msg.LeaseKey())
+	if !ok {
+		return nil
+	}
+	return c.client.DeleteQueueRow(v.(int64), c.consumer)
+}
+
+func (c *Broker) Nack(queueName string, msg message.Message) error {
+	v, ok := c.leases.LoadAndDelete(msg.LeaseKey())
+	if !ok {
+		return nil
+	}
+	_, err := c.client.ReleaseQueueRow(v.(int64), c.consumer)
+	return err
+}
+
+func (c *Broker) Touch(queueName string, msg message.Message) error {
+	v, ok := c.leases.Load(msg.LeaseKey())
+	if !ok {
+		return nil
+	}
+	n, err := c.client.ExtendQueueRow(v.(int64), c.consumer, time.Now().Add(c.visibilityTimeout))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (c *Broker) Requeue(queueName string) (int, error) {
+	n, err := c.client.RequeueExpired(queueName)
+	return int(n), err
+}
+
+func (c *Broker) Len(queueName string) (int, error) {
+	n, err := c.client.CountQueue(queueName)
+	return int(n), err
+}
+
+func (c *Broker) Range(queueName string, start int, stop int) ([]message.Message, error) {
+	rows, err := c.client.RangeQueue(queueName, start, stop)
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]message.Message, len(rows))
+	for i, row := range rows {
+		if err = yjson.TaskJson.UnmarshalFromString(row.Payload, &msgs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return msgs, nil
+}
+
+func (c *Broker) Remove(queueName string, id string) (message.Message, error) {
+	var msg message.Message
+	row, err := c.client.RemoveQueueRow(queueName, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return msg, ierrors.ErrNotFound{Id: id}
+		}
+		return msg, err
+	}
+	err = yjson.TaskJson.UnmarshalFromString(row.Payload, &msg)
+	return msg, err
+}
+
+func (c *Broker) Purge(queueName string) error {
+	return c.client.PurgeQueue(queueName)
+}
+
+func (c Broker) Clone() brokers.BrokerInterface {
+	return &Broker{
+		host:              c.host,
+		port:              c.port,
+		user:              c.user,
+		password:          c.password,
+		db:                c.db,
+		idleConn:          c.idleConn,
+		maxConn:           c.maxConn,
+		idleTime:          c.idleTime,
+		maxTime:           c.maxTime,
+		visibilityTimeout: c.visibilityTimeout,
+	}
+}
+
+// newConsumerId 每个Broker实例一个消费者id
+func newConsumerId() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b))
+}
@@ -0,0 +1,117 @@
+package mysql
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eopenio/itask/v3/ierrors"
+	"github.com/eopenio/itask/v3/message"
+)
+
+// newTestBroker 设置 ITASK_TEST_MYSQL=user:password@host:port/db 后运行
+func newTestBroker(t *testing.T) *Broker {
+	dsn := os.Getenv("ITASK_TEST_MYSQL")
+	if dsn == "" {
+		t.Skip("ITASK_TEST_MYSQL is not set")
+	}
+	userInfo, rest, _ := strings.Cut(dsn, "@")
+	user, password, _ := strings.Cut(userInfo, ":")
+	addr, db, _ := strings.Cut(rest, "/")
+	host, port, _ := strings.Cut(addr, ":")
+	b := NewMySQLBroker(host, port, user, password, db, 2, 10, 60, 60)
+	b.Activate()
+	return &b
+}
+
+func testQueueName() string {
+	return "itask-test:" + message.NewMessage(message.NewMsgArgs()).Id
+}
+
+// 多个消费者同时领取，每条消息只被领取一次
+func TestBrokerClaimOnce(t *testing.T) {
+	sender := newTestBroker(t)
+	q := testQueueName()
+	defer sender.Purge(q)
+
+	sent := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		msg := message.NewMessage(message.NewMsgArgs())
+		if err := sender.Send(q, msg); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+		sent[msg.Id] = true
+	}
+
+	var mu sync.Mutex
+	claimed := make(map[string]int)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		b := newTestBroker(t)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				msgs, err := b.NextN(q, 3)
+				if err != nil {
+					if !ierrors.IsEqual(err, ierrors.ErrTypeEmptyQueue) {
+						t.Errorf("NextN() error = %v", err)
+					}
+					return
+				}
+				mu.Lock()
+				for _, msg := range msgs {
+					claimed[msg.Id]++
+					b.Ack(q, msg)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for id := range sent {
+		if claimed[id] != 1 {
+			t.Errorf("message %s is claimed %d times", id, claimed[id])
+		}
+	}
+}
+
+// 租约精确到毫秒，过期后被其它消费者领取，原来的消费者不能再确认
+func TestBrokerLease(t *testing.T) {
+	a, b := newTestBroker(t), newTestBroker(t)
+	a.SetVisibilityTimeout(300 * time.Millisecond)
+	q := testQueueName()
+	defer a.Purge(q)
+
+	sent := message.NewMessage(message.NewMsgArgs())
+	if err := a.Send(q, sent); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	lost, err := a.Next(q)
+	if err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	if n, _ := a.Requeue(q); n != 0 {
+		t.Fatalf("Requeue() before the lease expires = %d, want 0", n)
+	}
+	time.Sleep(500 * time.Millisecond)
+	if n, err := a.Requeue(q); n != 1 || err != nil {
+		t.Fatalf("Requeue() = %d, %v, want 1", n, err)
+	}
+	msg, err := b.Next(q)
+	if err != nil || msg.Id != sent.Id {
+		t.Fatalf("Next() of the requeued message = %s, %v, want %s", msg.Id, err, sent.Id)
+	}
+	if err = a.Ack(q, lost); err != nil {
+		t.Fatalf("Ack() with a lost lease error = %v", err)
+	}
+	if err = b.Touch(q, msg); err != nil {
+		t.Errorf("Touch() after another consumer's Ack error = %v", err)
+	}
+	if err = b.Ack(q, msg); err != nil {
+		t.Errorf("Ack() error = %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package mysql
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	queueStatusReady   = 0
+	queueStatusClaimed = 1
+)
+
+type QueueTable struct {
+	Id          int64      `json:"id,omitempty" gorm:"primaryKey"`
+	QueueName   string     `json:"queueName" gorm:"column:queue_name;comment:队列名称;type:varchar(191);size:191;index:idx_queue_status_seq,priority:1"`
+	Status      int        `json:"status" gorm:"column:status;comment:0:等待 1:已领取;type:tinyint;index:idx_queue_status_seq,priority:2;index:idx_status_lease,priority:1"`
+	Seq         int64      `json:"seq" gorm:"column:seq;comment:排序，LSend为负数;type:bigint;index:idx_queue_status_seq,priority:3"`
+	TaskId      string     `json:"taskId" gorm:"column:task_id;comment:任务ID;type:varchar(50);size:50;index:idx_task_id"`
+	Payload     string     `json:"payload" gorm:"column:payload;comment:消息内容;type:mediumtext;"`
+	AvailableAt time.Time  `json:"availableAt" gorm:"column:available_at;comment:可以领取的时间;type:DATETIME(3)"`
+	Consumer    string     `json:"consumer" gorm:"column:consumer;comment:领取的消费者;type:varchar(100);size:100;"`
+	LeaseUntil  *time.Time `json:"leaseUntil" gorm:"column:lease_until;comment:租约到期时间;type:DATETIME(3);index:idx_status_lease,priority:2"`
+	CreateAt    time.Time  `json:"createAt,omitempty" gorm:"column:create_at;comment:创建时间;type:TIMESTAMP;default:CURRENT_TIMESTAMP;<-:CREATE"`
+}
+
+func (QueueTable) TableName() string {
+	return "tb_message_queue"
+}
+
+func (c *Client) AutoMigrateQueue() error {
+	return c.mysql.Set("gorm:table_options", "ENGINE=InnoDB").AutoMigrate(&QueueTable{})
+}
+
+// PushQueue
+//   - isRight: false时插入到队首
+func (c *Client) PushQueue(queueName string, taskId string, payload string, availableAt time.Time, isRight bool) error {
+	seq := time.Now().UnixNano()
+	if !isRight {
+		seq = -seq
+	}
+	row := QueueTable{
+		QueueName:   queueName,
+		Status:      queueStatusReady,
+		Seq:         seq,
+		TaskId:      taskId,
+		Payload:     payload,
+		AvailableAt: availableAt,
+	}
+	return c.mysql.Create(&row).Error
+}
+
+// PushQueueBatch 一条INSERT插入所有消息，顺序与payloads一致
+func (c *Client) PushQueueBatch(queueName string, taskIds []string, payloads []string, availableAt time.Time) error {
+	seq := time.Now().UnixNano()
+	rows := make([]QueueTable, len(payloads))
+	for i, payload := range payloads {
+		rows[i] = QueueTable{
+			QueueName:   queueName,
+			Status:      queueStatusReady,
+			Seq:         seq + int64(i),
+			TaskId:      taskIds[i],
+			Payload:     payload,
+			AvailableAt: availableAt,
+		}
+	}
+	return c.mysql.Create(&rows).Error
+}
+
+// ClaimQueue 领取队列中第一个可用的消息，其他消费者锁住的行会被跳过(SKIP LOCKED, mysql >= 8.0)
+// 没有消息时返回 gorm.ErrRecordNotFound
+func (c *Client) ClaimQueue(queueName string, consumer string, leaseUntil time.Time) (QueueTable, error) {
+	rows, err := c.ClaimQueueN(queueName, consumer, leaseUntil, 1)
+	if err != nil {
+		return QueueTable{}, err
+	}
+	return rows[0], nil
+}
+
+// ClaimQueueN 在一个事务中领取最多n个消息，按顺序返回
+func (c *Client) ClaimQueueN(queueName string, consumer string, leaseUntil time.Time, n int) ([]QueueTable, error) {
+	var rows []QueueTable
+	err := c.mysql.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("queue_name = ? AND status = ? AND available_at <= ?", queueName, queueStatusReady, time.Now()).
+			Order("seq").Limit(n).Find(&rows).Error
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		ids := make([]int64, len(rows))
+		for i := range rows {
+			ids[i] = rows[i].Id
+			rows[i].Status = queueStatusClaimed
+			rows[i].Consumer = consumer
+			rows[i].LeaseUntil = &leaseUntil
+		}
+		return tx.Model(&QueueTable{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"status":      queueStatusClaimed,
+			"consumer":    consumer,
+			"lease_until": leaseUntil,
+		}).Error
+	})
+	return rows, err
+}
+
+// DeleteQueueRow 只删除consumer仍然持有租约的消息，租约到期被放回或被其它消费者领取后不会删除
+func (c *Client) DeleteQueueRow(id int64, consumer string) error {
+	return c.mysql.Where("id = ? AND status = ? AND consumer = ?", id, queueStatusClaimed, consumer).Delete(&QueueTable{}).Error
+}
+
+// ReleaseQueueRow 放回队列，保留原来的顺序
+func (c *Client) ReleaseQueueRow(id int64, consumer string) (int64, error) {
+	r := c.mysql.Model(&QueueTable{}).
+		Where("id = ? AND status = ? AND consumer = ?", id, queueStatusClaimed, consumer).
+		Updates(map[string]interface{}{
+			"status":      queueStatusReady,
+			"lease_until": nil,
+		})
+	return r.RowsAffected, r.Error
+}
+
+func (c *Client) ExtendQueueRow(id int64, consumer string, leaseUntil time.Time) (int64, error) {
+	r := c.mysql.Model(&QueueTable{}).
+		Where("id = ? AND status = ? AND consumer = ?", id, queueStatusClaimed, consumer).
+		Update("lease_until", leaseUntil)
+	return r.RowsAffected, r.Error
+}
+
+// RequeueExpired 租约到期的消息放回队列，保留原来的顺序
+func (c *Client) RequeueExpired(queueName string) (int64, error) {
+	r := c.mysql.Model(&QueueTable{}).
+		Where("queue_name = ? AND status = ? AND lease_until < ?", queueName, queueStatusClaimed, time.Now()).
+		Updates(map[string]interface{}{
+			"status":      queueStatusReady,
+			"lease_until": nil,
+		})
+	return r.RowsAffected, r.Error
+}
+
+func (c *Client) CountQueue(queueName string) (int64, error) {
+	var n int64
+	err := c.mysql.Model(&QueueTable{}).Where("queue_name = ? AND status = ?", queueName, queueStatusReady).Count(&n).Error
+	return n, err
+}
+
+// RangeQueue stop=-1 表示到最后一个
+func (c *Client) RangeQueue(queueName string, start int, stop int) ([]QueueTable, error) {
+	var rows []QueueTable
+	q := c.mysql.Where("queue_name = ? AND status = ?", queueName, queueStatusReady).Order("seq").Offset(start)
+	if stop >= 0 {
+		if stop < start {
+			return nil, nil
+		}
+		q = q.Limit(stop - start + 1)
+	}
+	err := q.Find(&rows).Error
+	return rows, err
+}
+
+// RemoveQueueRow 删除并返回task_id对应的等待中的消息
+func (c *Client) RemoveQueueRow(queueName string, taskId string) (QueueTable, error) {
+	var row QueueTable
+	err := c.mysql.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("queue_name = ? AND status = ? AND task_id = ?", queueName, queueStatusReady, taskId).
+			Take(&row).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("id = ?", row.Id).Delete(&QueueTable{}).Error
+	})
+	return row, err
+}
+
+func (c *Client) PurgeQueue(queueName string) error {
+	return c.mysql.Where("queue_name = ?", queueName).Delete(&QueueTable{}).Error
+}
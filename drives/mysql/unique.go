@@ -0,0 +1,56 @@
+package mysql
+
+import (
+	"time"
+)
+
+// UniqueTable Client.SendUnique 记录的key
+type UniqueTable struct {
+	KeyName  string    `json:"keyName" gorm:"column:key_name;comment:去重key;type:varchar(191);size:191;primaryKey"`
+	Value    string    `json:"value" gorm:"column:value;comment:任务ID;type:varchar(50);size:50;"`
+	ExpireAt time.Time `json:"expireAt" gorm:"column:expire_at;comment:过期时间;type:DATETIME(3);index:idx_expire_at"`
+}
+
+func (UniqueTable) TableName() string {
+	return "tb_unique_key"
+}
+
+func (c *Client) AutoMigrateUnique() error {
+	return c.mysql.Set("gorm:table_options", "ENGINE=InnoDB").AutoMigrate(&UniqueTable{})
+}
+
+// SetUnique key不存在或已过期时保存value，返回 (value, true)；否则返回已有的值和false
+// 一条INSERT ... ON DUPLICATE KEY UPDATE 完成，赋值从左到右执行，所以value的判断用的是旧的expire_at
+func (c *Client) SetUnique(key string, value string, exTime time.Duration) (string, bool, error) {
+	now := time.Now()
+	err := c.mysql.Exec("INSERT INTO tb_unique_key (key_name, value, expire_at) VALUES (?, ?, ?) "+
+		"ON DUPLICATE KEY UPDATE value = IF(expire_at <= ?, VALUES(value), value), "+
+		"expire_at = IF(expire_at <= ?, VALUES(expire_at), expire_at)",
+		key, value, now.Add(exTime), now, now).Error
+	if err != nil {
+		return "", false, err
+	}
+	var row UniqueTable
+	if err = c.mysql.Where("key_name = ?", key).Take(&row).Error; err != nil {
+		return "", false, err
+	}
+	return row.Value, row.Value == value, nil
+}
+
+// DelUnique key的值是value时才删除
+func (c *Client) DelUnique(key string, value string) error {
+	return c.mysql.Where("key_name = ? AND value = ?", key, value).Delete(&UniqueTable{}).Error
+}
+
+// ExpireUnique key的值是value且未过期时重新设置过期时间
+func (c *Client) ExpireUnique(key string, value string, exTime time.Duration) (bool, error) {
+	now := time.Now()
+	r := c.mysql.Model(&UniqueTable{}).Where("key_name = ? AND value = ? AND expire_at > ?", key, value, now).
+		Update("expire_at", now.Add(exTime))
+	return r.RowsAffected > 0, r.Error
+}
+
+// DeleteExpiredUnique 每次最多删除1000条过期的key
+func (c *Client) DeleteExpiredUnique() error {
+	return c.mysql.Exec("DELETE FROM tb_unique_key WHERE expire_at <= ? LIMIT 1000", time.Now()).Error
+}
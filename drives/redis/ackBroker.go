@@ -0,0 +1,277 @@
+package redis
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eopenio/itask/v3/brokers"
+	"github.com/eopenio/itask/v3/ierrors"
+	"github.com/eopenio/itask/v3/message"
+	"github.com/eopenio/itask/v3/util/compress"
+	"github.com/go-redis/redis/v8"
+)
+
+// 取出消息的同时放入当前消费者的处理列表，并记录租约
+// KEYS: queue, processing, lease 三个一组，按顺序检查
+var nextScript = redis.NewScript(`
+for i = 1, #KEYS, 3 do
+	local payload = redis.call('LPOP', KEYS[i])
+	if payload then
+		redis.call('RPUSH', KEYS[i + 1], payload)
+		redis.call('ZADD', KEYS[i + 2], ARGV[1], ARGV[2] .. '|' .. payload)
+		return {KEYS[i], payload}
+	end
+end
+return false
+`)
+
+// 一次取出最多ARGV[3]条消息，KEYS: queue, processing, lease
+var nextNScript = redis.NewScript(`
+local payloads = {}
+for i = 1, tonumber(ARGV[3]) do
+	local payload = redis.call('LPOP', KEYS[1])
+	if not payload then
+		break
+	end
+	redis.call('RPUSH', KEYS[2], payload)
+	redis.call('ZADD', KEYS[3], ARGV[1], ARGV[2] .. '|' .. payload)
+	payloads[i] = payload
+end
+return payloads
+`)
+
+var ackScript = redis.NewScript(`
+redis.call('LREM', KEYS[1], 1, ARGV[1])
+return redis.call('ZREM', KEYS[2], ARGV[2])
+`)
+
+// 租约已被Requeue回收时不再重复放回队列
+var nackScript = redis.NewScript(`
+if redis.call('ZREM', KEYS[3], ARGV[2]) == 0 then
+	return 0
+end
+redis.call('LREM', KEYS[2], 1, ARGV[1])
+redis.call('LPUSH', KEYS[1], ARGV[1])
+return 1
+`)
+
+var touchScript = redis.NewScript(`
+if redis.call('ZSCORE', KEYS[1], ARGV[2]) then
+	redis.call('ZADD', KEYS[1], ARGV[1], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// 租约成员格式为 consumer|payload，KEYS: queue, processing, lease
+var requeueScript = redis.NewScript(`
+local members = redis.call('ZRANGEBYSCORE', KEYS[3], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, member in ipairs(members) do
+	local sep = string.find(member, '|', 1, true)
+	local payload = string.sub(member, sep + 1)
+	redis.call('LREM', KEYS[2], 1, payload)
+	redis.call('LPUSH', KEYS[1], payload)
+	redis.call('ZREM', KEYS[3], member)
+end
+return #members
+`)
+
+var ErrLeaseLost = errors.New("Task: lease of message is lost")
+
+type lease struct {
+	payload string
+	member  string
+}
+
+// AckBroker
+// Redis broker with at-least-once delivery.
+// Next moves the message to the processing list of the queue and records a lease of the consumer in a sorted set,
+// leases not acked within the visibility timeout are put back to the queue by Requeue.
+type AckBroker struct {
+	Broker
+	consumer          string
+	visibilityTimeout time.Duration
+	leases            *sync.Map // [delivery]lease
+	seq               uint64    // 生成delivery
+}
+
+// NewRedisAckBroker
+//   - poolSize: Maximum number of idle connections in client pool.
+//     If clientPoolSize<=0, clientPoolSize=10
+func NewRedisAckBroker(host string, port string, password string, db int, poolSize int) AckBroker {
+	return AckBroker{
+		Broker:            NewRedisBroker(host, port, password, db, poolSize),
+		visibilityTimeout: 5 * time.Minute,
+	}
+}
+
+func (r *AckBroker) Activate() {
+	r.Broker.Activate()
+	r.consumer = newConsumerId()
+	r.leases = &sync.Map{}
+}
+
+func (r *AckBroker) SetVisibilityTimeout(d time.Duration) {
+	r.visibilityTimeout = d
+}
+
+func (r *AckBroker) GetVisibilityTimeout() time.Duration {
+	return r.visibilityTimeout
+}
+
+func (r *AckBroker) nextDelivery() string {
+	return strconv.FormatUint(atomic.AddUint64(&r.seq, 1), 10)
+}
+
+// processingKey 一个队列的所有消费者共用处理列表，脚本用到的key都在KEYS中声明
+func (r *AckBroker) processingKey(queueName string) string {
+	return queueName + ":processing"
+}
+
+func (r *AckBroker) leaseKey(queueName string) string {
+	return queueName + ":lease"
+}
+
+func (r *AckBroker) deadline() int64 {
+	return time.Now().Add(r.visibilityTimeout).UnixMilli()
+}
+
+func (r *AckBroker) Next(queueName string) (message.Message, error) {
+	return r.NextFrom(queueName)
+}
+
+func (r *AckBroker) NextFrom(queueNames ...string) (message.Message, error) {
+	var msg message.Message
+	keys := make([]string, 0, len(queueNames)*3)
+	for _, queueName := range queueNames {
+		keys = append(keys, queueName, r.processingKey(queueName), r.leaseKey(queueName))
+	}
+
+	// lua脚本不能阻塞，这里轮询，最多等待2秒（与Broker.Next的BLPop一致）
+	end := time.Now().Add(2 * time.Second)
+	for {
+		values, err := r.client.RunScript(nextScript, keys, r.deadline(), r.consumer).StringSlice()
+		if err == nil {
+			queueName, payload := values[0], values[1]
+			err = compress.UnmarshalFromString(payload, &msg)
+			if err != nil {
+				// 无法解析的消息重新投递也没有意义，直接确认
+				r.client.RunScript(ackScript, []string{r.processingKey(queueName), r.leaseKey(queueName)}, payload, r.consumer+"|"+payload)
+				return msg, err
+			}
+			msg.Delivery = r.nextDelivery()
+			r.leases.Store(msg.Delivery, lease{payload: payload, member: r.consumer + "|" + payload})
+			return msg, nil
+		}
+		if err != redis.Nil {
+			return msg, err
+		}
+		if time.Now().After(end) {
+			return msg, ierrors.ErrEmptyQueue{}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// NextN 取出最多n条消息并记录租约，不等待
+func (r *AckBroker) NextN(queueName string, n int) ([]message.Message, error) {
+	keys := []string{queueName, r.processingKey(queueName), r.leaseKey(queueName)}
+	values, err := r.client.RunScript(nextNScript, keys, r.deadline(), r.consumer, n).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, ierrors.ErrEmptyQueue{}
+	}
+	msgs := make([]message.Message, 0, len(values))
+	var firstErr error
+	for _, payload := range values {
+		var msg message.Message
+		member := r.consumer + "|" + payload
+		if err = compress.UnmarshalFromString(payload, &msg); err != nil {
+			// 无法解析的消息重新投递也没有意义，直接确认
+			r.client.RunScript(ackScript, keys[1:], payload, member)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		msg.Delivery = r.nextDelivery()
+		r.leases.Store(msg.Delivery, lease{payload: payload, member: member})
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) == 0 {
+		return nil, firstErr
+	}
+	return msgs, nil
+}
+
+func (r *AckBroker) Ack(queueName string, msg message.Message) error {
+	v, ok := r.leases.LoadAndDelete(msg.LeaseKey())
+	if !ok {
+		return nil
+	}
+	l := v.(lease)
+	keys := []string{r.processingKey(queueName), r.leaseKey(queueName)}
+	return r.client.RunScript(ackScript, keys, l.payload, l.member).Err()
+}
+
+func (r *AckBroker) Nack(queueName string, msg message.Message) error {
+	v, ok := r.leases.LoadAndDelete(msg.LeaseKey())
+	if !ok {
+		return nil
+	}
+	l := v.(lease)
+	keys := []string{queueName, r.processingKey(queueName), r.leaseKey(queueName)}
+	return r.client.RunScript(nackScript, keys, l.payload, l.member).Err()
+}
+
+func (r *AckBroker) Touch(queueName string, msg message.Message) error {
+	v, ok := r.leases.Load(msg.LeaseKey())
+	if !ok {
+		return nil
+	}
+	l := v.(lease)
+	n, err := r.client.RunScript(touchScript, []string{r.leaseKey(queueName)}, r.deadline(), l.member).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (r *AckBroker) Requeue(queueName string) (int, error) {
+	keys := []string{queueName, r.processingKey(queueName), r.leaseKey(queueName)}
+	return r.client.RunScript(requeueScript, keys, time.Now().UnixMilli(), 100).Int()
+}
+
+func (r AckBroker) Clone() brokers.BrokerInterface {
+	return &AckBroker{
+		Broker: Broker{
+			host:       r.host,
+			port:       r.port,
+			password:   r.password,
+			db:         r.db,
+			poolSize:   r.poolSize,
+			compressor: r.compressor,
+		},
+		visibilityTimeout: r.visibilityTimeout,
+	}
+}
+
+// newConsumerId 每个AckBroker实例一个消费者id，用于区分租约
+func newConsumerId() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(b))
+}
@@ -0,0 +1,56 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/eopenio/itask/v3/ierrors"
+	"github.com/eopenio/itask/v3/message"
+)
+
+func TestAckBroker(t *testing.T) {
+	host, port := testRedisAddr(t)
+	b := NewRedisAckBroker(host, port, "", 0, 3)
+	b.Activate()
+	b.SetVisibilityTimeout(100 * time.Millisecond)
+	q := testQueueName()
+	defer b.client.Do("DEL", q, b.processingKey(q), b.leaseKey(q))
+
+	sent := message.NewMessage(message.NewMsgArgs())
+	if err := b.Send(q, sent); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	// Nack放回队列，可以马上再次取出
+	msg, err := b.Next(q)
+	if err != nil || msg.Id != sent.Id {
+		t.Fatalf("Next() = %s, %v, want %s", msg.Id, err, sent.Id)
+	}
+	if err = b.Nack(q, msg); err != nil {
+		t.Fatalf("Nack() error = %v", err)
+	}
+	if msg, err = b.Next(q); err != nil || msg.Id != sent.Id {
+		t.Fatalf("Next() after Nack = %s, %v, want %s", msg.Id, err, sent.Id)
+	}
+
+	// 租约到期后Requeue放回队列，旧的租约失效
+	time.Sleep(200 * time.Millisecond)
+	if n, err := b.Requeue(q); n != 1 || err != nil {
+		t.Fatalf("Requeue() = %d, %v, want 1", n, err)
+	}
+	if err = b.Touch(q, msg); err != ErrLeaseLost {
+		t.Errorf("Touch() of a requeued message error = %v, want %v", err, ErrLeaseLost)
+	}
+	if msg, err = b.Next(q); err != nil || msg.Id != sent.Id {
+		t.Fatalf("Next() after Requeue = %s, %v, want %s", msg.Id, err, sent.Id)
+	}
+	if err = b.Ack(q, msg); err != nil {
+		t.Fatalf("Ack() error = %v", err)
+	}
+	if n, _ := b.client.Do("LLEN", b.processingKey(q)).Int(); n != 0 {
+		t.Errorf("%d messages left in the processing list after Ack", n)
+	}
+	if _, err = b.Next(q); !ierrors.IsEqual(err, ierrors.ErrTypeEmptyQueue) {
+		t.Errorf("Next() after Ack error = %v, want empty queue", err)
+	}
+}
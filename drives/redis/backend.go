@@ -5,11 +5,63 @@ import (
 	"github.com/eopenio/itask/v3/backends"
 	"github.com/eopenio/itask/v3/ierrors"
 	"github.com/eopenio/itask/v3/message"
-	"github.com/eopenio/itask/v3/util/yjson"
+	"github.com/eopenio/itask/v3/util/compress"
 	"github.com/go-redis/redis/v8"
 	"time"
 )
 
+// key不存在时保存并返回false，否则返回已有的值
+var setUniqueScript = redis.NewScript(`
+local v = redis.call('GET', KEYS[1])
+if v then
+	return v
+end
+redis.call('SET', KEYS[1], ARGV[1], 'EX', ARGV[2])
+return false
+`)
+
+var delUniqueScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+var expireUniqueScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('EXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// 令牌桶，KEYS[1]: hash {tokens, ts}, ARGV: rate(每秒), burst, now(毫秒)
+// 返回需要等待的毫秒数，0表示取到了令牌
+var takeTokenScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(b[1])
+local ts = tonumber(b[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+if now < ts then
+	now = ts
+end
+tokens = math.min(burst, tokens + (now - ts) * rate / 1000)
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+else
+	wait = math.ceil((1 - tokens) * 1000 / rate)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+return wait
+`)
+
 type Backend struct {
 	client   *Client
 	host     string
@@ -17,6 +69,8 @@ type Backend struct {
 	password string
 	db       int
 	poolSize int
+
+	compressor compress.Compressor
 }
 
 // NewRedisBackend
@@ -38,6 +92,11 @@ func (r *Backend) Activate() {
 	r.client = &client
 }
 
+// SetCompressor 结果超过阈值时压缩，读取时总是自动解压
+func (r *Backend) SetCompressor(c compress.Compressor) {
+	r.compressor = c
+}
+
 func (r *Backend) SetPoolSize(n int) {
 	r.poolSize = n
 }
@@ -47,7 +106,7 @@ func (r *Backend) GetPoolSize() int {
 }
 
 func (r *Backend) SetResult(result message.Result, exTime int) error {
-	b, err := yjson.TaskJson.Marshal(result)
+	b, err := r.compressor.Marshal(result)
 
 	if err != nil {
 		return err
@@ -67,16 +126,65 @@ func (r *Backend) GetResult(key string) (message.Result, error) {
 		return result, err
 	}
 
-	err = yjson.TaskJson.Unmarshal(b, &result)
+	err = compress.Unmarshal(b, &result)
 	return result, err
 }
 
+func (r *Backend) DelResult(key string) error {
+	return r.client.Del(key)
+}
+
+func (r *Backend) SetUnique(key string, value string, exTime int) (string, bool, error) {
+	v, err := r.client.RunScript(setUniqueScript, []string{key}, value, exTime).Text()
+	if errors.Is(err, redis.Nil) {
+		return value, true, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return v, false, nil
+}
+
+func (r *Backend) DelUnique(key string, value string) error {
+	return r.client.RunScript(delUniqueScript, []string{key}, value).Err()
+}
+
+func (r *Backend) ExpireUnique(key string, value string, exTime int) (bool, error) {
+	n, err := r.client.RunScript(expireUniqueScript, []string{key}, value, exTime).Int()
+	return n == 1, err
+}
+
+// TakeToken 令牌桶保存在redis中，所有server共享，使用各server自己的时钟
+func (r *Backend) TakeToken(key string, rate float64, burst int) (time.Duration, error) {
+	ms, err := r.client.RunScript(takeTokenScript, []string{key}, rate, burst, time.Now().UnixMilli()).Int64()
+	return time.Duration(ms) * time.Millisecond, err
+}
+
+func (r *Backend) PublishAbort(id string, reason string) error {
+	return r.client.Publish(backends.AbortChannel, backends.EncodeAbortSignal(id, reason))
+}
+
+// SubscribeAbort 断线时go-redis会自动重新订阅，期间的信号由server的定时检查补上
+func (r *Backend) SubscribeAbort(f func(id string, reason string)) (func(), error) {
+	ps, err := r.client.Subscribe(backends.AbortChannel)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for m := range ps.Channel() {
+			f(backends.DecodeAbortSignal(m.Payload))
+		}
+	}()
+	return func() { ps.Close() }, nil
+}
+
 func (r Backend) Clone() backends.BackendInterface {
 	return &Backend{
-		host:     r.host,
-		port:     r.port,
-		password: r.password,
-		db:       r.db,
-		poolSize: r.poolSize,
+		host:       r.host,
+		port:       r.port,
+		password:   r.password,
+		db:         r.db,
+		poolSize:   r.poolSize,
+		compressor: r.compressor,
 	}
 }
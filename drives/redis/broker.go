@@ -4,7 +4,7 @@ import (
 	"github.com/eopenio/itask/v3/brokers"
 	"github.com/eopenio/itask/v3/ierrors"
 	"github.com/eopenio/itask/v3/message"
-	"github.com/eopenio/itask/v3/util/yjson"
+	"github.com/eopenio/itask/v3/util/compress"
 	"github.com/go-redis/redis/v8"
 	"time"
 )
@@ -16,6 +16,8 @@ type Broker struct {
 	password string
 	db       int
 	poolSize int
+
+	compressor compress.Compressor
 }
 
 // NewRedisBroker
@@ -36,6 +38,11 @@ func (r *Broker) Activate() {
 	r.client = &client
 }
 
+// SetCompressor 消息超过阈值时压缩，读取时总是自动解压
+func (r *Broker) SetCompressor(c compress.Compressor) {
+	r.compressor = c
+}
+
 func (r *Broker) SetPoolSize(n int) {
 	r.poolSize = n
 }
@@ -53,12 +60,41 @@ func (r *Broker) Next(queueName string) (message.Message, error) {
 		return msg, err
 	}
 
-	err = yjson.TaskJson.UnmarshalFromString(values[1], &msg)
+	err = compress.UnmarshalFromString(values[1], &msg)
 	return msg, err
 }
 
+func (r *Broker) NextFrom(queueNames ...string) (message.Message, error) {
+	var msg message.Message
+	values, err := r.client.BLPopFirst(2*time.Second, queueNames...).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return msg, ierrors.ErrEmptyQueue{}
+		}
+		return msg, err
+	}
+
+	err = compress.UnmarshalFromString(values[1], &msg)
+	return msg, err
+}
+
+// NextN 一次LPOP取出最多n条消息(redis >= 6.2)，不等待
+func (r *Broker) NextN(queueName string, n int) ([]message.Message, error) {
+	values, err := r.client.LPopCount(queueName, n)
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ierrors.ErrEmptyQueue{}
+		}
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, ierrors.ErrEmptyQueue{}
+	}
+	return unmarshalBatch(values)
+}
+
 func (r *Broker) Send(queueName string, msg message.Message) error {
-	b, err := yjson.TaskJson.Marshal(msg)
+	b, err := r.compressor.Marshal(msg)
 
 	if err != nil {
 		return err
@@ -67,8 +103,32 @@ func (r *Broker) Send(queueName string, msg message.Message) error {
 	return err
 }
 
+// SendBatch 一次RPUSH发送所有消息
+func (r *Broker) SendBatch(queueName string, msgs []message.Message) []error {
+	errs := make([]error, len(msgs))
+	values := make([]interface{}, 0, len(msgs))
+	index := make([]int, 0, len(msgs))
+	for i, msg := range msgs {
+		b, err := r.compressor.Marshal(msg)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		values = append(values, b)
+		index = append(index, i)
+	}
+	if len(values) > 0 {
+		if err := r.client.RPush(queueName, values...); err != nil {
+			for _, i := range index {
+				errs[i] = err
+			}
+		}
+	}
+	return batchErrors(errs)
+}
+
 func (r *Broker) LSend(queueName string, msg message.Message) error {
-	b, err := yjson.TaskJson.Marshal(msg)
+	b, err := r.compressor.Marshal(msg)
 
 	if err != nil {
 		return err
@@ -77,13 +137,123 @@ func (r *Broker) LSend(queueName string, msg message.Message) error {
 	return err
 }
 
+func (r *Broker) Len(queueName string) (int, error) {
+	n, err := r.client.LLen(queueName)
+	return int(n), err
+}
+
+func (r *Broker) Range(queueName string, start int, stop int) ([]message.Message, error) {
+	values, err := r.client.LRange(queueName, int64(start), int64(stop))
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]message.Message, len(values))
+	for i, v := range values {
+		if err = compress.UnmarshalFromString(v, &msgs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return msgs, nil
+}
+
+func (r *Broker) Remove(queueName string, id string) (message.Message, error) {
+	var msg message.Message
+	values, err := r.client.LRange(queueName, 0, -1)
+	if err != nil {
+		return msg, err
+	}
+	for _, v := range values {
+		if compress.UnmarshalFromString(v, &msg) != nil || msg.Id != id {
+			continue
+		}
+		n, err := r.client.LRem(queueName, 1, v)
+		if err != nil {
+			return msg, err
+		}
+		// 已经被其他客户端删除
+		if n == 0 {
+			break
+		}
+		return msg, nil
+	}
+	return message.Message{}, ierrors.ErrNotFound{Id: id}
+}
+
+// RemoveBatch 只扫描一次队列，按原始内容LREM，出错时也返回已删除的消息
+func (r *Broker) RemoveBatch(queueName string, ids []string) ([]message.Message, error) {
+	want := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		want[id] = struct{}{}
+	}
+	values, err := r.client.LRange(queueName, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	var msgs []message.Message
+	for _, v := range values {
+		var msg message.Message
+		if compress.UnmarshalFromString(v, &msg) != nil {
+			continue
+		}
+		if _, ok := want[msg.Id]; !ok {
+			continue
+		}
+		n, err := r.client.LRem(queueName, 1, v)
+		if err != nil {
+			return msgs, err
+		}
+		// 已经被其他客户端删除
+		if n == 0 {
+			continue
+		}
+		delete(want, msg.Id)
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+func (r *Broker) Purge(queueName string) error {
+	return r.client.Del(queueName)
+}
+
 func (r Broker) Clone() brokers.BrokerInterface {
 
 	return &Broker{
-		host:     r.host,
-		port:     r.port,
-		password: r.password,
-		db:       r.db,
-		poolSize: r.poolSize,
+		host:       r.host,
+		port:       r.port,
+		password:   r.password,
+		db:         r.db,
+		poolSize:   r.poolSize,
+		compressor: r.compressor,
+	}
+}
+
+// unmarshalBatch 跳过无法解析的消息，全部无法解析时返回第一个错误
+func unmarshalBatch(values []string) ([]message.Message, error) {
+	msgs := make([]message.Message, 0, len(values))
+	var firstErr error
+	for _, payload := range values {
+		var msg message.Message
+		if err := compress.UnmarshalFromString(payload, &msg); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) == 0 {
+		return nil, firstErr
+	}
+	return msgs, nil
+}
+
+// batchErrors 全部成功时返回nil
+func batchErrors(errs []error) []error {
+	for _, err := range errs {
+		if err != nil {
+			return errs
+		}
 	}
+	return nil
 }
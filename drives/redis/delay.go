@@ -0,0 +1,64 @@
+package redis
+
+import (
+	"time"
+
+	"github.com/eopenio/itask/v3/message"
+	"github.com/eopenio/itask/v3/util/compress"
+	"github.com/go-redis/redis/v8"
+)
+
+// 把到时间的延时消息从有序集合移到队列
+var moveDueScript = redis.NewScript(`
+local items = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, payload in ipairs(items) do
+	redis.call('RPUSH', KEYS[2], payload)
+	redis.call('ZREM', KEYS[1], payload)
+end
+return #items
+`)
+
+// ARGV[3]: stream的maxLen，<=0不裁剪
+var moveDueStreamScript = redis.NewScript(`
+local items = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, payload in ipairs(items) do
+	if tonumber(ARGV[3]) > 0 then
+		redis.call('XADD', KEYS[2], 'MAXLEN', '~', ARGV[3], '*', ARGV[4], payload)
+	else
+		redis.call('XADD', KEYS[2], '*', ARGV[4], payload)
+	end
+	redis.call('ZREM', KEYS[1], payload)
+end
+return #items
+`)
+
+// delayedKey 延时消息的有序集合，score为运行时间（毫秒）
+func delayedKey(queueName string) string {
+	return queueName + ":delayed"
+}
+
+func schedule(client *Client, c compress.Compressor, queueName string, msg message.Message, runAt time.Time) error {
+	b, err := c.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return client.ZAdd(delayedKey(queueName), float64(runAt.UnixMilli()), b)
+}
+
+func (r *Broker) Schedule(queueName string, msg message.Message, runAt time.Time) error {
+	return schedule(r.client, r.compressor, queueName, msg, runAt)
+}
+
+func (r *Broker) MoveDue(queueName string, limit int) (int, error) {
+	keys := []string{delayedKey(queueName), queueName}
+	return r.client.RunScript(moveDueScript, keys, time.Now().UnixMilli(), limit).Int()
+}
+
+func (r *StreamBroker) Schedule(queueName string, msg message.Message, runAt time.Time) error {
+	return schedule(r.client, r.compressor, queueName, msg, runAt)
+}
+
+func (r *StreamBroker) MoveDue(queueName string, limit int) (int, error) {
+	keys := []string{delayedKey(queueName), queueName}
+	return r.client.RunScript(moveDueStreamScript, keys, time.Now().UnixMilli(), limit, r.maxLen, streamPayloadField).Int()
+}
@@ -44,21 +44,110 @@ func (c *Client) Set(key string, value interface{}, exTime time.Duration) error
 	return c.redisPool.Set(context.Background(), key, value, exTime).Err()
 }
 
-func (c *Client) RPush(key string, value interface{}) error {
-	return c.redisPool.RPush(context.Background(), key, value).Err()
+func (c *Client) RPush(key string, values ...interface{}) error {
+	return c.redisPool.RPush(context.Background(), key, values...).Err()
 }
 
 func (c *Client) LPush(key string, value interface{}) error {
 	return c.redisPool.LPush(context.Background(), key, value).Err()
 }
 
+// LPopCount redis >= 6.2
+func (c *Client) LPopCount(key string, count int) ([]string, error) {
+	return c.redisPool.LPopCount(context.Background(), key, count).Result()
+}
+
 func (c *Client) BLPop(key string, timeout time.Duration) *redis.StringSliceCmd {
 	return c.redisPool.BLPop(context.Background(), timeout, key)
 }
 
+func (c *Client) LLen(key string) (int64, error) {
+	return c.redisPool.LLen(context.Background(), key).Result()
+}
+
+func (c *Client) LRange(key string, start int64, stop int64) ([]string, error) {
+	return c.redisPool.LRange(context.Background(), key, start, stop).Result()
+}
+
+func (c *Client) LRem(key string, count int64, value interface{}) (int64, error) {
+	return c.redisPool.LRem(context.Background(), key, count, value).Result()
+}
+
+func (c *Client) Del(keys ...string) error {
+	return c.redisPool.Del(context.Background(), keys...).Err()
+}
+
+func (c *Client) ZAdd(key string, score float64, member interface{}) error {
+	return c.redisPool.ZAdd(context.Background(), key, &redis.Z{Score: score, Member: member}).Err()
+}
+
+func (c *Client) RunScript(script *redis.Script, keys []string, args ...interface{}) *redis.Cmd {
+	return script.Run(context.Background(), c.redisPool, keys, args...)
+}
+
+// BLPopFirst 按顺序检查keys，返回第一个非空列表的元素
+func (c *Client) BLPopFirst(timeout time.Duration, keys ...string) *redis.StringSliceCmd {
+	return c.redisPool.BLPop(context.Background(), timeout, keys...)
+}
+
+func (c *Client) XAdd(a *redis.XAddArgs) *redis.StringCmd {
+	return c.redisPool.XAdd(context.Background(), a)
+}
+
+func (c *Client) XGroupCreateMkStream(stream string, group string, start string) error {
+	return c.redisPool.XGroupCreateMkStream(context.Background(), stream, group, start).Err()
+}
+
+func (c *Client) XReadGroup(a *redis.XReadGroupArgs) *redis.XStreamSliceCmd {
+	return c.redisPool.XReadGroup(context.Background(), a)
+}
+
+func (c *Client) XAck(stream string, group string, ids ...string) error {
+	return c.redisPool.XAck(context.Background(), stream, group, ids...).Err()
+}
+
+func (c *Client) XPending(stream string, group string) *redis.XPendingCmd {
+	return c.redisPool.XPending(context.Background(), stream, group)
+}
+
+func (c *Client) XPendingExt(a *redis.XPendingExtArgs) *redis.XPendingExtCmd {
+	return c.redisPool.XPendingExt(context.Background(), a)
+}
+
+func (c *Client) XLen(stream string) (int64, error) {
+	return c.redisPool.XLen(context.Background(), stream).Result()
+}
+
+func (c *Client) XRange(stream string, start string, stop string) *redis.XMessageSliceCmd {
+	return c.redisPool.XRange(context.Background(), stream, start, stop)
+}
+
+func (c *Client) XDel(stream string, ids ...string) (int64, error) {
+	return c.redisPool.XDel(context.Background(), stream, ids...).Result()
+}
+
+// Pipelined 在一次请求中执行fn中的所有命令
+func (c *Client) Pipelined(fn func(redis.Pipeliner) error) ([]redis.Cmder, error) {
+	return c.redisPool.Pipelined(context.Background(), fn)
+}
+
 func (c *Client) Do(args ...interface{}) *redis.Cmd {
 	var ctx = context.Background()
-	return c.redisPool.Do(ctx, args)
+	return c.redisPool.Do(ctx, args...)
+}
+
+func (c *Client) Publish(channel string, message interface{}) error {
+	return c.redisPool.Publish(context.Background(), channel, message).Err()
+}
+
+// Subscribe 等待订阅成功后返回
+func (c *Client) Subscribe(channels ...string) (*redis.PubSub, error) {
+	ps := c.redisPool.Subscribe(context.Background(), channels...)
+	if _, err := ps.Receive(context.Background()); err != nil {
+		ps.Close()
+		return nil, err
+	}
+	return ps, nil
 }
 
 func (c *Client) Flush() error {
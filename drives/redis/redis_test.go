@@ -0,0 +1,27 @@
+package redis
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testRedisAddr 需要redis >= 6.2，设置 ITASK_TEST_REDIS=host:port 后运行
+func testRedisAddr(t *testing.T) (host string, port string) {
+	addr := os.Getenv("ITASK_TEST_REDIS")
+	if addr == "" {
+		t.Skip("ITASK_TEST_REDIS is not set")
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return host, port
+}
+
+// testQueueName 每个测试使用不同的队列
+func testQueueName() string {
+	return "itask-test:" + strconv.FormatInt(time.Now().UnixNano(), 10)
+}
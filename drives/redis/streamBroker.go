@@ -0,0 +1,542 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eopenio/itask/v3/brokers"
+	"github.com/eopenio/itask/v3/ierrors"
+	"github.com/eopenio/itask/v3/message"
+	"github.com/eopenio/itask/v3/util/compress"
+	"github.com/go-redis/redis/v8"
+)
+
+const streamPayloadField = "msg"
+
+// KEYS: stream; ARGV: group, entry id, field, payload
+var releaseScript = redis.NewScript(`
+redis.call('XADD', KEYS[1], '*', ARGV[3], ARGV[4])
+return redis.call('XACK', KEYS[1], ARGV[1], ARGV[2])
+`)
+
+// StreamPendingStats 消费组中已投递但未确认的消息统计
+type StreamPendingStats struct {
+	Count     int64
+	Lower     string           // 最小的消息id
+	Higher    string           // 最大的消息id
+	Consumers map[string]int64 // [consumer]未确认的消息数
+}
+
+// StreamPendingEntry 单条未确认的消息
+type StreamPendingEntry struct {
+	Id         string
+	Consumer   string
+	Idle       time.Duration
+	RetryCount int64 // 投递次数
+}
+
+// StreamBroker
+// Redis Streams broker with consumer groups, require redis >= 6.2.
+// Next reads new entries by XREADGROUP and claims entries that stay pending longer than
+// the visibility timeout (e.g. the consumer died) by XAUTOCLAIM, Ack confirms them by XACK.
+// Acked entries stay in the stream as history until trimmed by maxLen.
+type StreamBroker struct {
+	client   *Client
+	host     string
+	port     string
+	password string
+	db       int
+	poolSize int
+
+	group             string
+	consumer          string
+	maxLen            int64
+	visibilityTimeout time.Duration
+	compressor        compress.Compressor
+
+	groups    *sync.Map // [stream]struct{} 已创建消费组的stream
+	leases    *sync.Map // [delivery]entryId
+	lastClaim *sync.Map // [stream]time.Time
+}
+
+// NewRedisStreamBroker
+//   - poolSize: Maximum number of idle connections in client pool.
+//     If clientPoolSize<=0, clientPoolSize=10
+//   - group: name of the consumer group, default: itask
+//   - maxLen: approximate max length of each stream, older entries are trimmed. <=0: never trim
+func NewRedisStreamBroker(host string, port string, password string, db int, poolSize int, group string, maxLen int64) StreamBroker {
+	if group == "" {
+		group = "itask"
+	}
+	return StreamBroker{
+		host:              host,
+		port:              port,
+		password:          password,
+		db:                db,
+		poolSize:          poolSize,
+		group:             group,
+		maxLen:            maxLen,
+		visibilityTimeout: 5 * time.Minute,
+	}
+}
+
+func (r *StreamBroker) Activate() {
+	client := NewRedisClient(r.host, r.port, r.password, r.db, r.poolSize)
+	r.client = &client
+	r.consumer = newConsumerId()
+	r.groups = &sync.Map{}
+	r.leases = &sync.Map{}
+	r.lastClaim = &sync.Map{}
+}
+
+// SetCompressor 消息超过阈值时压缩，读取时总是自动解压
+func (r *StreamBroker) SetCompressor(c compress.Compressor) {
+	r.compressor = c
+}
+
+func (r *StreamBroker) SetPoolSize(n int) {
+	r.poolSize = n
+}
+
+func (r *StreamBroker) GetPoolSize() int {
+	return r.poolSize
+}
+
+func (r *StreamBroker) SetVisibilityTimeout(d time.Duration) {
+	r.visibilityTimeout = d
+}
+
+func (r *StreamBroker) GetVisibilityTimeout() time.Duration {
+	return r.visibilityTimeout
+}
+
+func (r *StreamBroker) ensureGroup(stream string) error {
+	if _, ok := r.groups.Load(stream); ok {
+		return nil
+	}
+	err := r.client.XGroupCreateMkStream(stream, r.group, "0")
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	r.groups.Store(stream, struct{}{})
+	return nil
+}
+
+func (r *StreamBroker) Next(queueName string) (message.Message, error) {
+	return r.NextFrom(queueName)
+}
+
+// NextFrom
+// describe: check the streams in order without waiting, if all are empty wait for any of them
+// by one XREADGROUP, at most 2 seconds (like Broker.Next)
+func (r *StreamBroker) NextFrom(queueNames ...string) (message.Message, error) {
+	var msg message.Message
+	for _, queueName := range queueNames {
+		if err := r.ensureGroup(queueName); err != nil {
+			return msg, err
+		}
+	}
+	for _, queueName := range queueNames {
+		entry, err := r.claimStale(queueName)
+		if err != nil {
+			return msg, err
+		}
+		if entry == nil {
+			entries, err := r.readNew(queueName, 1)
+			if err != nil {
+				return msg, err
+			}
+			if len(entries) > 0 {
+				entry = &entries[0]
+			}
+		}
+		if entry != nil {
+			return r.decodeEntry(queueName, *entry)
+		}
+	}
+
+	streams := append([]string(nil), queueNames...)
+	for range queueNames {
+		streams = append(streams, ">")
+	}
+	result, err := r.client.XReadGroup(&redis.XReadGroupArgs{
+		Group:    r.group,
+		Consumer: r.consumer,
+		Streams:  streams,
+		Count:    1,
+		Block:    2 * time.Second,
+	}).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return msg, ierrors.ErrEmptyQueue{}
+		}
+		return msg, err
+	}
+	// 等待时几个stream同时收到消息会一起返回，只取第一个，其它的放回stream
+	var stream string
+	var entry *redis.XMessage
+	for _, queueName := range queueNames {
+		for i := range result {
+			if result[i].Stream != queueName || len(result[i].Messages) == 0 {
+				continue
+			}
+			if entry == nil {
+				stream, entry = queueName, &result[i].Messages[0]
+				continue
+			}
+			for _, e := range result[i].Messages {
+				if err := r.release(queueName, e); err != nil {
+					return msg, err
+				}
+			}
+		}
+	}
+	if entry == nil {
+		return msg, ierrors.ErrEmptyQueue{}
+	}
+	return r.decodeEntry(stream, *entry)
+}
+
+// readNew 读取最多count条新消息，不等待
+func (r *StreamBroker) readNew(stream string, count int) ([]redis.XMessage, error) {
+	streams, err := r.client.XReadGroup(&redis.XReadGroupArgs{
+		Group:    r.group,
+		Consumer: r.consumer,
+		Streams:  []string{stream, ">"},
+		Count:    int64(count),
+		Block:    -1,
+	}).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	if len(streams) == 0 {
+		return nil, nil
+	}
+	return streams[0].Messages, nil
+}
+
+// release 把已读取的消息重新添加到stream末尾，并确认原来的消息
+func (r *StreamBroker) release(stream string, entry redis.XMessage) error {
+	payload, _ := entry.Values[streamPayloadField].(string)
+	return r.client.RunScript(releaseScript, []string{stream}, r.group, entry.ID, streamPayloadField, payload).Err()
+}
+
+// NextN 取出最多n条消息，不等待；其他消费者超时未确认的消息优先
+func (r *StreamBroker) NextN(queueName string, n int) ([]message.Message, error) {
+	if err := r.ensureGroup(queueName); err != nil {
+		return nil, err
+	}
+	var entries []redis.XMessage
+	entry, err := r.claimStale(queueName)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		entries = append(entries, *entry)
+	}
+	if len(entries) < n {
+		newEntries, err := r.readNew(queueName, n-len(entries))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, newEntries...)
+	}
+	if len(entries) == 0 {
+		return nil, ierrors.ErrEmptyQueue{}
+	}
+	msgs := make([]message.Message, 0, len(entries))
+	var firstErr error
+	for _, e := range entries {
+		msg, err := r.decodeEntry(queueName, e)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) == 0 {
+		return nil, firstErr
+	}
+	return msgs, nil
+}
+
+// claimStale 每秒最多一次，认领其他消费者超时未确认的消息
+func (r *StreamBroker) claimStale(stream string) (*redis.XMessage, error) {
+	if v, ok := r.lastClaim.Load(stream); ok && time.Since(v.(time.Time)) < time.Second {
+		return nil, nil
+	}
+	r.lastClaim.Store(stream, time.Now())
+
+	// go-redis v8 无法解析 redis 7 的 XAUTOCLAIM 返回值，这里自己解析
+	reply, err := r.client.Do("XAUTOCLAIM", stream, r.group, r.consumer,
+		r.visibilityTimeout.Milliseconds(), "0-0", "COUNT", 1).Slice()
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) < 2 {
+		return nil, nil
+	}
+	entries, _ := reply[1].([]interface{})
+	for _, e := range entries {
+		entry, ok := parseXMessage(e)
+		if ok {
+			return &entry, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *StreamBroker) decodeEntry(stream string, entry redis.XMessage) (message.Message, error) {
+	var msg message.Message
+	payload, _ := entry.Values[streamPayloadField].(string)
+	err := compress.UnmarshalFromString(payload, &msg)
+	if err != nil {
+		// 无法解析的消息重新投递也没有意义，直接确认
+		r.client.XAck(stream, r.group, entry.ID)
+		return msg, err
+	}
+	// entry id 每次添加都不同，用作delivery
+	msg.Delivery = entry.ID
+	r.leases.Store(msg.Delivery, entry.ID)
+	return msg, nil
+}
+
+func (r *StreamBroker) add(queueName string, msg message.Message) error {
+	args, err := r.xAddArgs(queueName, msg)
+	if err != nil {
+		return err
+	}
+	return r.client.XAdd(args).Err()
+}
+
+func (r *StreamBroker) xAddArgs(queueName string, msg message.Message) (*redis.XAddArgs, error) {
+	b, err := r.compressor.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	args := &redis.XAddArgs{
+		Stream: queueName,
+		Values: map[string]interface{}{streamPayloadField: b},
+	}
+	if r.maxLen > 0 {
+		args.MaxLen = r.maxLen
+		args.Approx = true
+	}
+	return args, nil
+}
+
+// SendBatch 用pipeline在一次请求中XADD所有消息
+func (r *StreamBroker) SendBatch(queueName string, msgs []message.Message) []error {
+	errs := make([]error, len(msgs))
+	cmds := make([]*redis.StringCmd, len(msgs))
+	_, err := r.client.Pipelined(func(pipe redis.Pipeliner) error {
+		for i, msg := range msgs {
+			args, err := r.xAddArgs(queueName, msg)
+			if err != nil {
+				errs[i] = err
+				continue
+			}
+			cmds[i] = pipe.XAdd(context.Background(), args)
+		}
+		return nil
+	})
+	for i, cmd := range cmds {
+		if cmd == nil {
+			continue
+		}
+		errs[i] = cmd.Err()
+		if errs[i] == nil && err != nil {
+			errs[i] = err
+		}
+	}
+	return batchErrors(errs)
+}
+
+func (r *StreamBroker) Send(queueName string, msg message.Message) error {
+	return r.add(queueName, msg)
+}
+
+// LSend stream不能插入到队首，与Send相同
+func (r *StreamBroker) LSend(queueName string, msg message.Message) error {
+	return r.add(queueName, msg)
+}
+
+func (r *StreamBroker) Ack(queueName string, msg message.Message) error {
+	v, ok := r.leases.LoadAndDelete(msg.LeaseKey())
+	if !ok {
+		return nil
+	}
+	return r.client.XAck(queueName, r.group, v.(string))
+}
+
+// Nack 重新添加到stream，并确认原来的消息
+func (r *StreamBroker) Nack(queueName string, msg message.Message) error {
+	v, ok := r.leases.LoadAndDelete(msg.LeaseKey())
+	if !ok {
+		return nil
+	}
+	if err := r.add(queueName, msg); err != nil {
+		r.leases.Store(msg.LeaseKey(), v)
+		return err
+	}
+	return r.client.XAck(queueName, r.group, v.(string))
+}
+
+// 消息仍属于当前消费者时才重新认领，已被其他消费者 XAUTOCLAIM 的消息不能抢回来
+// KEYS: stream, ARGV: group, consumer, entry id
+var streamTouchScript = redis.NewScript(`
+local entries = redis.call('XPENDING', KEYS[1], ARGV[1], ARGV[3], ARGV[3], 1)
+if #entries == 0 or entries[1][2] ~= ARGV[2] then
+	return 0
+end
+redis.call('XCLAIM', KEYS[1], ARGV[1], ARGV[2], 0, ARGV[3], 'JUSTID')
+return 1
+`)
+
+// Touch 重新认领自己的消息以重置空闲时间
+func (r *StreamBroker) Touch(queueName string, msg message.Message) error {
+	v, ok := r.leases.Load(msg.LeaseKey())
+	if !ok {
+		return nil
+	}
+	n, err := r.client.RunScript(streamTouchScript, []string{queueName}, r.group, r.consumer, v.(string)).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// Requeue 超时的消息由Next通过XAUTOCLAIM认领，这里不需要处理
+func (r *StreamBroker) Requeue(queueName string) (int, error) {
+	return 0, nil
+}
+
+// PendingStats 消费组中未确认的消息统计
+func (r *StreamBroker) PendingStats(queueName string) (StreamPendingStats, error) {
+	p, err := r.client.XPending(queueName, r.group).Result()
+	if err != nil {
+		return StreamPendingStats{}, err
+	}
+	return StreamPendingStats{
+		Count:     p.Count,
+		Lower:     p.Lower,
+		Higher:    p.Higher,
+		Consumers: p.Consumers,
+	}, nil
+}
+
+// PendingEntries 最早的count条未确认消息
+func (r *StreamBroker) PendingEntries(queueName string, count int64) ([]StreamPendingEntry, error) {
+	entries, err := r.client.XPendingExt(&redis.XPendingExtArgs{
+		Stream: queueName,
+		Group:  r.group,
+		Start:  "-",
+		End:    "+",
+		Count:  count,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	r2 := make([]StreamPendingEntry, len(entries))
+	for i, e := range entries {
+		r2[i] = StreamPendingEntry{Id: e.ID, Consumer: e.Consumer, Idle: e.Idle, RetryCount: e.RetryCount}
+	}
+	return r2, nil
+}
+
+// Len 包括已确认但还没被裁剪的历史消息
+func (r *StreamBroker) Len(queueName string) (int, error) {
+	n, err := r.client.XLen(queueName)
+	return int(n), err
+}
+
+func (r *StreamBroker) Range(queueName string, start int, stop int) ([]message.Message, error) {
+	entries, err := r.client.XRange(queueName, "-", "+").Result()
+	if err != nil {
+		return nil, err
+	}
+	if stop < 0 || stop >= len(entries) {
+		stop = len(entries) - 1
+	}
+	if start < 0 {
+		start = 0
+	}
+	if start > stop {
+		return nil, nil
+	}
+	msgs := make([]message.Message, 0, stop-start+1)
+	for _, e := range entries[start : stop+1] {
+		var msg message.Message
+		payload, _ := e.Values[streamPayloadField].(string)
+		if err = compress.UnmarshalFromString(payload, &msg); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+func (r *StreamBroker) Remove(queueName string, id string) (message.Message, error) {
+	entries, err := r.client.XRange(queueName, "-", "+").Result()
+	if err != nil {
+		return message.Message{}, err
+	}
+	for _, e := range entries {
+		var msg message.Message
+		payload, _ := e.Values[streamPayloadField].(string)
+		if compress.UnmarshalFromString(payload, &msg) != nil || msg.Id != id {
+			continue
+		}
+		n, err := r.client.XDel(queueName, e.ID)
+		if err != nil {
+			return msg, err
+		}
+		if n == 0 {
+			break
+		}
+		return msg, nil
+	}
+	return message.Message{}, ierrors.ErrNotFound{Id: id}
+}
+
+func (r *StreamBroker) Purge(queueName string) error {
+	r.groups.Delete(queueName)
+	return r.client.Del(queueName)
+}
+
+func (r StreamBroker) Clone() brokers.BrokerInterface {
+	return &StreamBroker{
+		host:              r.host,
+		port:              r.port,
+		password:          r.password,
+		db:                r.db,
+		poolSize:          r.poolSize,
+		group:             r.group,
+		maxLen:            r.maxLen,
+		visibilityTimeout: r.visibilityTimeout,
+		compressor:        r.compressor,
+	}
+}
+
+// parseXMessage 解析 [id, [field, value, ...]]，已删除的消息为nil
+func parseXMessage(v interface{}) (redis.XMessage, bool) {
+	item, ok := v.([]interface{})
+	if !ok || len(item) != 2 {
+		return redis.XMessage{}, false
+	}
+	id, _ := item[0].(string)
+	fields, _ := item[1].([]interface{})
+	values := make(map[string]interface{}, len(fields)/2)
+	for i := 0; i+1 < len(fields); i += 2 {
+		k, _ := fields[i].(string)
+		values[k] = fields[i+1]
+	}
+	return redis.XMessage{ID: id, Values: values}, id != ""
+}
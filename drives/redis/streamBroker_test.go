@@ -0,0 +1,53 @@
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/eopenio/itask/v3/message"
+)
+
+func newTestStreamBroker(t *testing.T) *StreamBroker {
+	host, port := testRedisAddr(t)
+	b := NewRedisStreamBroker(host, port, "", 0, 3, "itask-test", 0)
+	b.Activate()
+	return &b
+}
+
+func TestStreamBrokerNextFrom(t *testing.T) {
+	b := newTestStreamBroker(t)
+	low := testQueueName()
+	high := low + ":p1"
+	defer b.client.Do("DEL", high, low)
+
+	lowMsg, highMsg := message.NewMessage(message.NewMsgArgs()), message.NewMessage(message.NewMsgArgs())
+	if err := b.Send(low, lowMsg); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if err := b.Send(high, highMsg); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	for _, want := range []struct {
+		stream string
+		msg    message.Message
+	}{{high, highMsg}, {low, lowMsg}} {
+		msg, err := b.NextFrom(high, low)
+		if err != nil || msg.Id != want.msg.Id {
+			t.Fatalf("NextFrom() = %s, %v, want %s", msg.Id, err, want.msg.Id)
+		}
+		if err = b.Ack(want.stream, msg); err != nil {
+			t.Fatalf("Ack() error = %v", err)
+		}
+	}
+
+	// 所有stream都为空时，一次XREADGROUP等待任意一个stream
+	waited := message.NewMessage(message.NewMsgArgs())
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		b.Send(low, waited)
+	}()
+	msg, err := b.NextFrom(high, low)
+	if err != nil || msg.Id != waited.Id {
+		t.Errorf("NextFrom() while waiting = %s, %v, want %s", msg.Id, err, waited.Id)
+	}
+}
@@ -0,0 +1,104 @@
+package sqlite
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/eopenio/itask/v3/backends"
+	"github.com/eopenio/itask/v3/ierrors"
+	"github.com/eopenio/itask/v3/message"
+	"github.com/eopenio/itask/v3/util/yjson"
+	"gorm.io/gorm"
+)
+
+// Backend
+// SQLite backend, results are kept in the table tb_kv and expire after exTime
+type Backend struct {
+	client *Client
+	path   string
+
+	mu          *sync.Mutex
+	lastCleanup time.Time
+}
+
+// NewSQLiteBackend
+//   - path: sqlite file, can be shared with SQLiteBroker and other processes
+func NewSQLiteBackend(path string) Backend {
+	return Backend{
+		path: path,
+	}
+}
+
+func (c *Backend) Activate() {
+	c.client = NewSQLiteClient(c.path)
+	c.mu = &sync.Mutex{}
+}
+
+func (c *Backend) SetPoolSize(n int) {
+}
+
+func (c *Backend) GetPoolSize() int {
+	return 0
+}
+
+func (c *Backend) SetResult(result message.Result, exTime int) error {
+	b, err := yjson.TaskJson.Marshal(result)
+	if err != nil {
+		return err
+	}
+	err = c.client.Set(result.GetBackendKey(), b, time.Duration(exTime)*time.Second)
+	if err != nil {
+		return err
+	}
+	c.cleanup()
+	return nil
+}
+
+func (c *Backend) GetResult(key string) (message.Result, error) {
+	var result message.Result
+	b, err := c.client.Get(key)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return result, ierrors.ErrNilResult{}
+		}
+		return result, err
+	}
+	err = yjson.TaskJson.Unmarshal(b, &result)
+	return result, err
+}
+
+func (c *Backend) DelResult(key string) error {
+	return c.client.Del(key)
+}
+
+func (c *Backend) SetUnique(key string, value string, exTime int) (string, bool, error) {
+	b, ok, err := c.client.SetNX(key, []byte(value), time.Duration(exTime)*time.Second)
+	return string(b), ok, err
+}
+
+func (c *Backend) DelUnique(key string, value string) error {
+	return c.client.DelIfEqual(key, []byte(value))
+}
+
+func (c *Backend) ExpireUnique(key string, value string, exTime int) (bool, error) {
+	return c.client.ExpireIfEqual(key, []byte(value), time.Duration(exTime)*time.Second)
+}
+
+// cleanup 每分钟最多一次，删除过期的结果
+func (c *Backend) cleanup() {
+	c.mu.Lock()
+	if time.Since(c.lastCleanup) < time.Minute {
+		c.mu.Unlock()
+		return
+	}
+	c.lastCleanup = time.Now()
+	c.mu.Unlock()
+	c.client.DeleteExpired()
+}
+
+func (c Backend) Clone() backends.BackendInterface {
+	return &Backend{
+		path: c.path,
+	}
+}
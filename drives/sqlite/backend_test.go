@@ -0,0 +1,56 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eopenio/itask/v3/ierrors"
+	"github.com/eopenio/itask/v3/message"
+)
+
+func TestBackendResult(t *testing.T) {
+	b := NewSQLiteBackend(filepath.Join(t.TempDir(), "itask.db"))
+	b.Activate()
+
+	result := message.NewResult("task-1")
+	result.Status = message.ResultStatus.Success
+	if err := b.SetResult(result, 1); err != nil {
+		t.Fatalf("SetResult() error = %v", err)
+	}
+	got, err := b.GetResult(result.GetBackendKey())
+	if err != nil || got.Id != result.Id || got.Status != result.Status {
+		t.Fatalf("GetResult() = %+v, %v, want %+v", got, err, result)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	if _, err = b.GetResult(result.GetBackendKey()); !ierrors.IsEqual(err, ierrors.ErrTypeNilResult) {
+		t.Errorf("GetResult() of an expired result error = %v, want nil result", err)
+	}
+}
+
+func TestBackendUnique(t *testing.T) {
+	b := NewSQLiteBackend(filepath.Join(t.TempDir(), "itask.db"))
+	b.Activate()
+
+	if v, ok, err := b.SetUnique("k", "a", 60); !ok || v != "a" || err != nil {
+		t.Fatalf("SetUnique() = %s, %v, %v, want a, true", v, ok, err)
+	}
+	if v, ok, _ := b.SetUnique("k", "b", 60); ok || v != "a" {
+		t.Errorf("SetUnique() of a recorded key = %s, %v, want a, false", v, ok)
+	}
+	// 只有持有者能续期和删除
+	if ok, _ := b.ExpireUnique("k", "b", 60); ok {
+		t.Error("ExpireUnique() by another value succeeded")
+	}
+	b.DelUnique("k", "b")
+	if ok, _ := b.ExpireUnique("k", "a", 60); !ok {
+		t.Error("ExpireUnique() by the owner failed")
+	}
+	if err := b.DelUnique("k", "a"); err != nil {
+		t.Fatalf("DelUnique() error = %v", err)
+	}
+	if _, ok, _ := b.SetUnique("k", "b", 60); !ok {
+		t.Error("SetUnique() after DelUnique failed")
+	}
+}
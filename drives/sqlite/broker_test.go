@@ -0,0 +1,64 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eopenio/itask/v3/message"
+)
+
+func newTestBroker(path string, visibilityTimeout time.Duration) *Broker {
+	b := NewSQLiteBroker(path)
+	b.Activate()
+	b.SetVisibilityTimeout(visibilityTimeout)
+	return &b
+}
+
+func TestBrokerAckAfterLeaseLost(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "itask.db")
+	a := newTestBroker(path, 50*time.Millisecond)
+	b := newTestBroker(path, time.Minute)
+
+	sent := message.NewMessage(message.NewMsgArgs())
+	if err := a.Send("q", sent); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	lost, err := a.Next("q")
+	if err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n, err := a.Requeue("q"); n != 1 || err != nil {
+		t.Fatalf("Requeue() = %d, %v, want 1", n, err)
+	}
+	msg, err := b.Next("q")
+	if err != nil || msg.Id != sent.Id {
+		t.Fatalf("Next() of the requeued message = %s, %v, want %s", msg.Id, err, sent.Id)
+	}
+
+	// a的租约已经丢失，不能删除b领取的消息
+	if err = a.Ack("q", lost); err != nil {
+		t.Fatalf("Ack() with a lost lease error = %v", err)
+	}
+	if err = b.Nack("q", msg); err != nil {
+		t.Fatalf("Nack() error = %v", err)
+	}
+	if n, _ := b.Len("q"); n != 1 {
+		t.Fatalf("Len() after Nack = %d, want 1", n)
+	}
+
+	msg, err = b.Next("q")
+	if err != nil {
+		t.Fatalf("Next() after Nack error = %v", err)
+	}
+	if err = b.Ack("q", msg); err != nil {
+		t.Fatalf("Ack() error = %v", err)
+	}
+	if n, err := b.Requeue("q"); n != 0 || err != nil {
+		t.Errorf("Requeue() after Ack = %d, %v, want 0", n, err)
+	}
+	if n, _ := b.Len("q"); n != 0 {
+		t.Errorf("Len() after Ack = %d, want 0", n)
+	}
+}
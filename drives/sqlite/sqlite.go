@@ -0,0 +1,291 @@
+package sqlite
+
+import (
+	"bytes"
+	"sort"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	queueStatusReady   = 0
+	queueStatusClaimed = 1
+)
+
+// QueueTable 时间都保存为毫秒时间戳，方便在sqlite中比较
+type QueueTable struct {
+	Id          int64  `gorm:"primaryKey;autoIncrement"`
+	QueueName   string `gorm:"column:queue_name;index:idx_queue_status_seq,priority:1"`
+	Status      int    `gorm:"column:status;index:idx_queue_status_seq,priority:2;index:idx_status_lease,priority:1"`
+	Seq         int64  `gorm:"column:seq;index:idx_queue_status_seq,priority:3"` // LSend为负数
+	TaskId      string `gorm:"column:task_id;index:idx_task_id"`
+	Payload     []byte `gorm:"column:payload"`
+	AvailableAt int64  `gorm:"column:available_at"` // 可以领取的时间
+	Consumer    string `gorm:"column:consumer"`
+	LeaseUntil  int64  `gorm:"column:lease_until;index:idx_status_lease,priority:2"` // 租约到期时间
+}
+
+func (QueueTable) TableName() string {
+	return "tb_message_queue"
+}
+
+type KVTable struct {
+	Key      string `gorm:"column:key_name;primaryKey"`
+	Value    []byte `gorm:"column:value"`
+	ExpireAt int64  `gorm:"column:expire_at;index:idx_expire_at"` // 0:不过期
+}
+
+func (KVTable) TableName() string {
+	return "tb_kv"
+}
+
+type Client struct {
+	path string
+	db   *gorm.DB
+}
+
+// NewSQLiteClient
+// several goroutines and processes can share one file: WAL mode, busy timeout,
+// and every write is a single statement so it never needs to upgrade a read lock
+func NewSQLiteClient(path string) *Client {
+	client := Client{path: path}
+	if err := client.Init(); err != nil {
+		panic("Task: init sqlite error: " + err.Error())
+	}
+	if err := client.AutoMigrate(); err != nil {
+		panic("Task: init sqlite error: " + err.Error())
+	}
+	return &client
+}
+
+func (c *Client) Init() error {
+	dsn := c.path + "?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		return err
+	}
+	c.db = db
+	sqlDB, err := c.db.DB()
+	if err != nil {
+		return err
+	}
+	sqlDB.SetConnMaxIdleTime(30 * time.Minute)
+	return sqlDB.Ping()
+}
+
+func (c *Client) AutoMigrate() error {
+	return c.db.AutoMigrate(&QueueTable{}, &KVTable{})
+}
+
+func (c *Client) Close() {
+	if sqlDB, err := c.db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
+
+// PushQueue
+//   - isRight: false时插入到队首
+func (c *Client) PushQueue(queueName string, taskId string, payload []byte, availableAt time.Time, isRight bool) error {
+	seq := time.Now().UnixNano()
+	if !isRight {
+		seq = -seq
+	}
+	return c.db.Create(&QueueTable{
+		QueueName:   queueName,
+		Status:      queueStatusReady,
+		Seq:         seq,
+		TaskId:      taskId,
+		Payload:     payload,
+		AvailableAt: availableAt.UnixMilli(),
+	}).Error
+}
+
+// PushQueueBatch 一条INSERT插入所有消息，顺序与payloads一致
+func (c *Client) PushQueueBatch(queueName string, taskIds []string, payloads [][]byte, availableAt time.Time) error {
+	seq := time.Now().UnixNano()
+	rows := make([]QueueTable, len(payloads))
+	for i, payload := range payloads {
+		rows[i] = QueueTable{
+			QueueName:   queueName,
+			Status:      queueStatusReady,
+			Seq:         seq + int64(i),
+			TaskId:      taskIds[i],
+			Payload:     payload,
+			AvailableAt: availableAt.UnixMilli(),
+		}
+	}
+	return c.db.Create(&rows).Error
+}
+
+// ClaimQueue 领取队列中第一个可用的消息，没有消息时返回 gorm.ErrRecordNotFound
+func (c *Client) ClaimQueue(queueName string, consumer string, leaseUntil time.Time) (QueueTable, error) {
+	rows, err := c.ClaimQueueN(queueName, consumer, leaseUntil, 1)
+	if err != nil {
+		return QueueTable{}, err
+	}
+	return rows[0], nil
+}
+
+// ClaimQueueN 一条UPDATE领取最多n个消息，按顺序返回
+func (c *Client) ClaimQueueN(queueName string, consumer string, leaseUntil time.Time, n int) ([]QueueTable, error) {
+	var rows []QueueTable
+	sub := c.db.Model(&QueueTable{}).Select("id").
+		Where("queue_name = ? AND status = ? AND available_at <= ?", queueName, queueStatusReady, time.Now().UnixMilli()).
+		Order("seq").Limit(n)
+	err := c.db.Model(&rows).Clauses(clause.Returning{}).
+		Where("id IN (?)", sub).
+		Updates(map[string]interface{}{
+			"status":      queueStatusClaimed,
+			"consumer":    consumer,
+			"lease_until": leaseUntil.UnixMilli(),
+		}).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	// RETURNING 不保证顺序
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Seq < rows[j].Seq })
+	return rows, nil
+}
+
+// DeleteQueueRow 只删除consumer仍然持有租约的消息，租约到期被放回或被其它消费者领取后不会删除
+func (c *Client) DeleteQueueRow(id int64, consumer string) error {
+	return c.db.Where("id = ? AND status = ? AND consumer = ?", id, queueStatusClaimed, consumer).Delete(&QueueTable{}).Error
+}
+
+// ReleaseQueueRow 放回队列，保留原来的顺序
+func (c *Client) ReleaseQueueRow(id int64, consumer string) (int64, error) {
+	r := c.db.Model(&QueueTable{}).
+		Where("id = ? AND status = ? AND consumer = ?", id, queueStatusClaimed, consumer).
+		Updates(map[string]interface{}{"status": queueStatusReady, "lease_until": 0})
+	return r.RowsAffected, r.Error
+}
+
+func (c *Client) ExtendQueueRow(id int64, consumer string, leaseUntil time.Time) (int64, error) {
+	r := c.db.Model(&QueueTable{}).
+		Where("id = ? AND status = ? AND consumer = ?", id, queueStatusClaimed, consumer).
+		Update("lease_until", leaseUntil.UnixMilli())
+	return r.RowsAffected, r.Error
+}
+
+// RequeueExpired 租约到期的消息放回队列，保留原来的顺序
+func (c *Client) RequeueExpired(queueName string) (int64, error) {
+	r := c.db.Model(&QueueTable{}).
+		Where("queue_name = ? AND status = ? AND lease_until < ?", queueName, queueStatusClaimed, time.Now().UnixMilli()).
+		Updates(map[string]interface{}{"status": queueStatusReady, "lease_until": 0})
+	return r.RowsAffected, r.Error
+}
+
+func (c *Client) CountQueue(queueName string) (int64, error) {
+	var n int64
+	err := c.db.Model(&QueueTable{}).Where("queue_name = ? AND status = ?", queueName, queueStatusReady).Count(&n).Error
+	return n, err
+}
+
+// RangeQueue stop=-1 表示到最后一个
+func (c *Client) RangeQueue(queueName string, start int, stop int) ([]QueueTable, error) {
+	var rows []QueueTable
+	q := c.db.Where("queue_name = ? AND status = ?", queueName, queueStatusReady).Order("seq").Offset(start)
+	if stop >= 0 {
+		if stop < start {
+			return nil, nil
+		}
+		q = q.Limit(stop - start + 1)
+	} else {
+		q = q.Limit(-1)
+	}
+	err := q.Find(&rows).Error
+	return rows, err
+}
+
+// RemoveQueueRow 删除并返回task_id对应的等待中的消息
+func (c *Client) RemoveQueueRow(queueName string, taskId string) (QueueTable, error) {
+	var rows []QueueTable
+	err := c.db.Clauses(clause.Returning{}).
+		Where("queue_name = ? AND status = ? AND task_id = ?", queueName, queueStatusReady, taskId).
+		Delete(&rows).Error
+	if err != nil {
+		return QueueTable{}, err
+	}
+	if len(rows) == 0 {
+		return QueueTable{}, gorm.ErrRecordNotFound
+	}
+	return rows[0], nil
+}
+
+func (c *Client) PurgeQueue(queueName string) error {
+	return c.db.Where("queue_name = ?", queueName).Delete(&QueueTable{}).Error
+}
+
+// Set exTime<=0 不过期
+func (c *Client) Set(key string, value []byte, exTime time.Duration) error {
+	var expireAt int64
+	if exTime > 0 {
+		expireAt = time.Now().Add(exTime).UnixMilli()
+	}
+	return c.db.Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(&KVTable{Key: key, Value: value, ExpireAt: expireAt}).Error
+}
+
+// Get 不存在或已过期时返回 gorm.ErrRecordNotFound
+func (c *Client) Get(key string) ([]byte, error) {
+	var row KVTable
+	err := c.db.Where("key_name = ? AND (expire_at = 0 OR expire_at > ?)", key, time.Now().UnixMilli()).Take(&row).Error
+	return row.Value, err
+}
+
+// SetNX key不存在或已过期时保存value，返回 (value, true)；否则返回已有的值和false
+func (c *Client) SetNX(key string, value []byte, exTime time.Duration) ([]byte, bool, error) {
+	now := time.Now().UnixMilli()
+	var expireAt int64
+	if exTime > 0 {
+		expireAt = time.Now().Add(exTime).UnixMilli()
+	}
+	// 一条语句完成，已过期的key直接覆盖
+	err := c.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key_name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "expire_at"}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Expr{SQL: "tb_kv.expire_at > 0 AND tb_kv.expire_at <= ?", Vars: []interface{}{now}},
+		}},
+	}).Create(&KVTable{Key: key, Value: value, ExpireAt: expireAt}).Error
+	if err != nil {
+		return nil, false, err
+	}
+	v, err := c.Get(key)
+	if err != nil {
+		return nil, false, err
+	}
+	return v, bytes.Equal(v, value), nil
+}
+
+func (c *Client) Del(key string) error {
+	return c.db.Where("key_name = ?", key).Delete(&KVTable{}).Error
+}
+
+// DelIfEqual key的值是value时才删除
+func (c *Client) DelIfEqual(key string, value []byte) error {
+	return c.db.Where("key_name = ? AND value = ?", key, value).Delete(&KVTable{}).Error
+}
+
+// ExpireIfEqual key的值是value且未过期时重新设置过期时间
+func (c *Client) ExpireIfEqual(key string, value []byte, exTime time.Duration) (bool, error) {
+	now := time.Now()
+	var expireAt int64
+	if exTime > 0 {
+		expireAt = now.Add(exTime).UnixMilli()
+	}
+	r := c.db.Model(&KVTable{}).Where("key_name = ? AND value = ? AND (expire_at = 0 OR expire_at > ?)", key, value, now.UnixMilli()).
+		Update("expire_at", expireAt)
+	return r.RowsAffected > 0, r.Error
+}
+
+func (c *Client) DeleteExpired() error {
+	return c.db.Where("expire_at > 0 AND expire_at <= ?", time.Now().UnixMilli()).Delete(&KVTable{}).Error
+}
@@ -1,6 +1,11 @@
 package backends
 
-import "github.com/eopenio/itask/v3/message"
+import (
+	"strings"
+	"time"
+
+	"github.com/eopenio/itask/v3/message"
+)
 
 type BackendInterface interface {
 	SetResult(result message.Result, exTime int) error
@@ -10,3 +15,60 @@ type BackendInterface interface {
 	GetPoolSize() int
 	Clone() BackendInterface
 }
+
+// UniqueBackendInterface
+// backends that can record deduplication keys atomically, used by Client.SendUnique
+type UniqueBackendInterface interface {
+	// SetUnique 如果key不存在或已过期，保存value并返回 (value, true)；否则不修改，返回已有的值和false
+	//   - exTime: 秒
+	SetUnique(key string, value string, exTime int) (string, bool, error)
+	// DelUnique key的值是value时才删除，用于发送失败后释放key
+	DelUnique(key string, value string) error
+}
+
+// LockBackendInterface
+// distributed locks on top of the deduplication keys: SetUnique acquires a lock, DelUnique releases it
+type LockBackendInterface interface {
+	UniqueBackendInterface
+	// ExpireUnique key的值是value时重新设置过期时间，返回false表示key已经不属于value
+	ExpireUnique(key string, value string, exTime int) (bool, error)
+}
+
+// RateLimitBackendInterface
+// token buckets shared by all servers, used by the server.RateLimit option of workers
+type RateLimitBackendInterface interface {
+	// TakeToken 从key的令牌桶中取一个令牌，成功时返回0，否则返回需要等待的时间
+	//   - rate: 每秒生成的令牌数
+	//   - burst: 桶的容量
+	TakeToken(key string, rate float64, burst int) (time.Duration, error)
+}
+
+// AbortBackendInterface
+// backends that push abort signals to the servers, so running tasks are aborted at once
+// instead of on the next periodic check (Config.AbortCheckInterval)
+type AbortBackendInterface interface {
+	PublishAbort(id string, reason string) error
+	// SubscribeAbort f is called with each signal until unsubscribe is called
+	SubscribeAbort(f func(id string, reason string)) (unsubscribe func(), err error)
+}
+
+// DelResultBackendInterface
+// backends that can delete a result, used to clear the abort flag of a replayed dead letter
+type DelResultBackendInterface interface {
+	DelResult(key string) error
+}
+
+// AbortChannel 发布中止信号的channel
+const AbortChannel = "itask:abort"
+
+// EncodeAbortSignal 任务id中没有 |
+func EncodeAbortSignal(id string, reason string) string {
+	return id + "|" + reason
+}
+
+func DecodeAbortSignal(s string) (id string, reason string) {
+	if i := strings.IndexByte(s, '|'); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
@@ -4,23 +4,50 @@ import (
 	"github.com/eopenio/itask/v3/drive"
 	"github.com/eopenio/itask/v3/ierrors"
 	"github.com/eopenio/itask/v3/message"
-	"github.com/eopenio/itask/v3/util/yjson"
+	"github.com/eopenio/itask/v3/util/compress"
+	"time"
 )
 
+// 令牌桶只在进程内共享
+var localBuckets = drive.NewTokenBuckets()
+
+// LocalBackend
+// file based backend, results are kept in dir and survive restarts.
 type LocalBackend struct {
-	client drive.LocalDrive
+	client     drive.LocalDrive
+	dir        string
+	compressor compress.Compressor
 }
 
+// NewLocalBackend 数据保存在系统临时目录
 func NewLocalBackend() LocalBackend {
 	return LocalBackend{}
 }
 
+func NewLocalBackendWithDir(dir string) LocalBackend {
+	return LocalBackend{dir: dir}
+}
+
+// SetCompressor 结果超过阈值时压缩，读取时总是自动解压
+func (l *LocalBackend) SetCompressor(c compress.Compressor) {
+	l.compressor = c
+}
+
 func (l *LocalBackend) Activate() {
-	l.client = drive.NewLocalDrive(false)
+	if l.dir == "" {
+		l.client = drive.NewLocalDrive(false)
+		return
+	}
+	// Activate不能返回错误，dir不可用时与NewLocalDrive一样panic
+	client, err := drive.NewLocalDriveWithDir(l.dir, false)
+	if err != nil {
+		panic("Task: activate local backend error: " + err.Error())
+	}
+	l.client = client
 }
 
 func (l *LocalBackend) SetResult(result message.Result, exTime int) error {
-	b, err := yjson.TaskJson.Marshal(result)
+	b, err := l.compressor.Marshal(result)
 
 	if err != nil {
 		return err
@@ -40,10 +67,32 @@ func (l *LocalBackend) GetResult(key string) (message.Result, error) {
 		return result, err
 	}
 
-	err = yjson.TaskJson.Unmarshal(b, &result)
+	err = compress.Unmarshal(b, &result)
 	return result, err
 }
 
+func (l *LocalBackend) DelResult(key string) error {
+	return l.client.DelKey(key)
+}
+
+func (l *LocalBackend) SetUnique(key string, value string, exTime int) (string, bool, error) {
+	b, ok, err := l.client.SetNX(key, []byte(value), exTime)
+	return string(b), ok, err
+}
+
+func (l *LocalBackend) DelUnique(key string, value string) error {
+	return l.client.DelIfEqual(key, []byte(value))
+}
+
+func (l *LocalBackend) ExpireUnique(key string, value string, exTime int) (bool, error) {
+	return l.client.ExpireIfEqual(key, []byte(value), exTime)
+}
+
+// TakeToken 令牌桶保存在内存中，只限制当前进程
+func (l *LocalBackend) TakeToken(key string, rate float64, burst int) (time.Duration, error) {
+	return localBuckets.Take(l.dir+"|"+key, rate, burst), nil
+}
+
 func (l *LocalBackend) SetPoolSize(i int) {
 
 }
@@ -53,5 +102,5 @@ func (l LocalBackend) GetPoolSize() int {
 }
 
 func (l *LocalBackend) Clone() BackendInterface {
-	return &LocalBackend{}
+	return &LocalBackend{dir: l.dir, compressor: l.compressor}
 }
@@ -0,0 +1,94 @@
+package backends
+
+import (
+	"github.com/eopenio/itask/v3/drive"
+	"github.com/eopenio/itask/v3/ierrors"
+	"github.com/eopenio/itask/v3/message"
+	"github.com/eopenio/itask/v3/util/yjson"
+	"time"
+)
+
+// MemoryBackend
+// in-process backend. Results are kept in memory and shared by all clones,
+// so a Server and the Client got from it see the same results.
+type MemoryBackend struct {
+	client *drive.MemoryDrive
+}
+
+func NewMemoryBackend() MemoryBackend {
+	return MemoryBackend{client: drive.NewMemoryDrive()}
+}
+
+func (l *MemoryBackend) Activate() {
+}
+
+func (l *MemoryBackend) SetResult(result message.Result, exTime int) error {
+	b, err := yjson.TaskJson.Marshal(result)
+	if err != nil {
+		return err
+	}
+	l.client.Set(result.GetBackendKey(), b, exTime)
+	return nil
+}
+
+func (l *MemoryBackend) GetResult(key string) (message.Result, error) {
+	var result message.Result
+
+	b, err := l.client.Get(key)
+	if err != nil {
+		if err == drive.NilResultError {
+			return result, ierrors.ErrNilResult{}
+		}
+		return result, err
+	}
+
+	err = yjson.TaskJson.Unmarshal(b, &result)
+	return result, err
+}
+
+func (l *MemoryBackend) DelResult(key string) error {
+	l.client.DelKey(key)
+	return nil
+}
+
+func (l *MemoryBackend) SetUnique(key string, value string, exTime int) (string, bool, error) {
+	b, ok := l.client.SetNX(key, []byte(value), exTime)
+	return string(b), ok, nil
+}
+
+func (l *MemoryBackend) DelUnique(key string, value string) error {
+	l.client.DelIfEqual(key, []byte(value))
+	return nil
+}
+
+func (l *MemoryBackend) ExpireUnique(key string, value string, exTime int) (bool, error) {
+	return l.client.ExpireIfEqual(key, []byte(value), exTime), nil
+}
+
+func (l *MemoryBackend) TakeToken(key string, rate float64, burst int) (time.Duration, error) {
+	return l.client.Buckets.Take(key, rate, burst), nil
+}
+
+func (l *MemoryBackend) PublishAbort(id string, reason string) error {
+	l.client.Publish(AbortChannel, []byte(EncodeAbortSignal(id, reason)))
+	return nil
+}
+
+func (l *MemoryBackend) SubscribeAbort(f func(id string, reason string)) (func(), error) {
+	return l.client.Subscribe(AbortChannel, func(b []byte) {
+		f(DecodeAbortSignal(string(b)))
+	}), nil
+}
+
+func (l *MemoryBackend) SetPoolSize(i int) {
+
+}
+
+func (l *MemoryBackend) GetPoolSize() int {
+	return 0
+}
+
+// Clone 共享同一个内存存储
+func (l *MemoryBackend) Clone() BackendInterface {
+	return &MemoryBackend{client: l.client}
+}
@@ -0,0 +1,59 @@
+package backends
+
+import (
+	"testing"
+	"time"
+
+	"github.com/eopenio/itask/v3/ierrors"
+	"github.com/eopenio/itask/v3/message"
+)
+
+func TestMemoryBackendShared(t *testing.T) {
+	b := NewMemoryBackend()
+	clone := b.Clone()
+
+	result := message.NewResult("task-1")
+	result.Status = message.ResultStatus.Success
+	if err := clone.SetResult(result, 60); err != nil {
+		t.Fatalf("SetResult() error = %v", err)
+	}
+	got, err := b.GetResult(result.GetBackendKey())
+	if err != nil || got.Status != result.Status {
+		t.Fatalf("GetResult() of a result saved by a clone = %+v, %v", got, err)
+	}
+	if err = b.DelResult(result.GetBackendKey()); err != nil {
+		t.Fatalf("DelResult() error = %v", err)
+	}
+	if _, err = clone.GetResult(result.GetBackendKey()); !ierrors.IsEqual(err, ierrors.ErrTypeNilResult) {
+		t.Errorf("GetResult() after DelResult error = %v, want nil result", err)
+	}
+}
+
+func TestMemoryBackendAbort(t *testing.T) {
+	b := NewMemoryBackend()
+	signals := make(chan string, 1)
+	unsubscribe, err := b.SubscribeAbort(func(id string, reason string) {
+		signals <- id + ":" + reason
+	})
+	if err != nil {
+		t.Fatalf("SubscribeAbort() error = %v", err)
+	}
+
+	b.Clone().(AbortBackendInterface).PublishAbort("task-1", "stop")
+	select {
+	case s := <-signals:
+		if s != "task-1:stop" {
+			t.Errorf("got abort signal %q, want task-1:stop", s)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("abort signal is not received")
+	}
+
+	unsubscribe()
+	b.PublishAbort("task-2", "stop")
+	select {
+	case s := <-signals:
+		t.Errorf("got abort signal %q after unsubscribe", s)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
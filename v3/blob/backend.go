@@ -0,0 +1,42 @@
+package blob
+
+import (
+	"encoding/base64"
+
+	"github.com/eopenio/itask/v3/backends"
+	"github.com/eopenio/itask/v3/ierrors"
+	"github.com/eopenio/itask/v3/message"
+)
+
+// BackendStore
+// blobs are saved as results with the key itask:backend:blob-<key>,
+// it keeps large payloads out of the broker, but not out of the backend
+type BackendStore struct {
+	backend backends.BackendInterface
+}
+
+// NewBackendStore b is activated here, use a backend that isn't shared with the servers
+func NewBackendStore(b backends.BackendInterface) BackendStore {
+	b.Activate()
+	return BackendStore{backend: b}
+}
+
+func (s BackendStore) Put(key string, data []byte, exTime int) error {
+	r := message.NewResult("blob-" + key)
+	r.FuncReturn = []string{base64.StdEncoding.EncodeToString(data)}
+	return s.backend.SetResult(r, exTime)
+}
+
+func (s BackendStore) Get(key string) ([]byte, error) {
+	r, err := s.backend.GetResult(message.NewResult("blob-" + key).GetBackendKey())
+	if err != nil {
+		if ierrors.IsEqual(err, ierrors.ErrTypeNilResult) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if len(r.FuncReturn) != 1 {
+		return nil, ErrNotFound
+	}
+	return base64.StdEncoding.DecodeString(r.FuncReturn[0])
+}
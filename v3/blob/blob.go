@@ -0,0 +1,95 @@
+package blob
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/eopenio/itask/v3/util/yjson"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotFound = errors.New("Task: blob not found or expired")
+	ErrChecksum = errors.New("Task: checksum of blob mismatch")
+)
+
+// 引用格式为 !blob:<key>#<sha256>，json编码的参数和加密后的参数都不会以 !blob: 开头
+// 引用中带有校验和，消息签名后blob的内容也不能被篡改
+const prefix = "!blob:"
+
+// StoreInterface
+// keeps large task args and results out of the broker and backend (claim-check),
+// messages and results only carry a reference to the blob
+type StoreInterface interface {
+	// Put exTime: seconds, -1:forever
+	Put(key string, data []byte, exTime int) error
+	// Get return ErrNotFound if the blob doesn't exist or is expired
+	Get(key string) ([]byte, error)
+}
+
+// IsRef 是否是Offload后的引用
+func IsRef(values []string) bool {
+	return len(values) == 1 && strings.HasPrefix(values[0], prefix)
+}
+
+// Offload
+// values not longer than threshold bytes in total are returned as is,
+// otherwise they are saved in store and replaced by a reference
+func Offload(store StoreInterface, values []string, threshold int, exTime int) ([]string, error) {
+	if store == nil || IsRef(values) {
+		return values, nil
+	}
+	var size int
+	for _, v := range values {
+		size += len(v)
+	}
+	if size <= threshold {
+		return values, nil
+	}
+	b, err := yjson.TaskJson.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	key := uuid.New().String()
+	if err = store.Put(key, b, exTime); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(b)
+	return []string{prefix + key + "#" + hex.EncodeToString(sum[:])}, nil
+}
+
+// Renew 重新保存引用的数据，从现在开始计算过期时间，不是引用时不做任何事
+func Renew(store StoreInterface, values []string, exTime int) error {
+	if store == nil || !IsRef(values) {
+		return nil
+	}
+	key, _, _ := strings.Cut(strings.TrimPrefix(values[0], prefix), "#")
+	b, err := store.Get(key)
+	if err != nil {
+		return err
+	}
+	return store.Put(key, b, exTime)
+}
+
+// Resolve 取回引用的数据，不是引用时原样返回
+func Resolve(store StoreInterface, values []string) ([]string, error) {
+	if !IsRef(values) {
+		return values, nil
+	}
+	if store == nil {
+		return nil, errors.New("Task: args are offloaded but no blob store is set")
+	}
+	key, checksum, _ := strings.Cut(strings.TrimPrefix(values[0], prefix), "#")
+	b, err := store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(b); hex.EncodeToString(sum[:]) != checksum {
+		return nil, ErrChecksum
+	}
+	var r []string
+	err = yjson.TaskJson.Unmarshal(b, &r)
+	return r, err
+}
@@ -0,0 +1,121 @@
+package blob
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const missingRef = prefix + "00000000-0000-0000-0000-000000000000#00"
+
+func TestOffloadResolve(t *testing.T) {
+	tests := []struct {
+		name      string
+		values    []string
+		threshold int
+		isRef     bool
+	}{
+		{"below threshold", []string{"1", "2"}, 10, false},
+		{"equal to threshold", []string{"12345", "67890"}, 10, false},
+		{"above threshold", []string{"12345", "678901"}, 10, true},
+		{"empty", []string{}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewFileStore(t.TempDir())
+			r, err := Offload(store, tt.values, tt.threshold, -1)
+			if err != nil {
+				t.Fatalf("Offload() error = %v", err)
+			}
+			if IsRef(r) != tt.isRef {
+				t.Errorf("IsRef(%q) = %v, want %v", r, IsRef(r), tt.isRef)
+			}
+			got, err := Resolve(store, r)
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.values) {
+				t.Errorf("Resolve() = %q, want %q", got, tt.values)
+			}
+		})
+	}
+}
+
+func TestResolveError(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  bool
+		ref     string
+		noStore bool
+		wantErr error
+	}{
+		{name: "tampered", tamper: true, wantErr: ErrChecksum},
+		{name: "missing", ref: missingRef, wantErr: ErrNotFound},
+		{name: "no store", noStore: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewFileStore(t.TempDir())
+			r, err := Offload(store, []string{"12345678901"}, 10, -1)
+			if err != nil {
+				t.Fatalf("Offload() error = %v", err)
+			}
+			if tt.tamper {
+				key, _, _ := strings.Cut(strings.TrimPrefix(r[0], prefix), "#")
+				store.Put(key, []byte(`["x"]`), -1)
+			}
+			if tt.ref != "" {
+				r = []string{tt.ref}
+			}
+			var s StoreInterface = store
+			if tt.noStore {
+				s = nil
+			}
+			_, err = Resolve(s, r)
+			if err == nil || tt.wantErr != nil && err != tt.wantErr {
+				t.Errorf("Resolve() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRenew(t *testing.T) {
+	store := NewFileStore(t.TempDir())
+	values := []string{"12345678901"}
+	r, err := Offload(store, values, 10, 1)
+	if err != nil {
+		t.Fatalf("Offload() error = %v", err)
+	}
+	if err = Renew(store, r, -1); err != nil {
+		t.Fatalf("Renew() error = %v", err)
+	}
+	if err = Renew(store, values, -1); err != nil {
+		t.Errorf("Renew() of values that are not a reference error = %v", err)
+	}
+	if err = Renew(store, []string{missingRef}, -1); err != ErrNotFound {
+		t.Errorf("Renew() of a missing blob error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestFileStoreRejectsPath(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret")
+	if err := os.WriteFile(secret, []byte("01234567secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	store := NewFileStore(filepath.Join(dir, "blobs"))
+	if _, err := store.Get("../secret"); err != ErrNotFound {
+		t.Errorf("Get(../secret) error = %v, want %v", err, ErrNotFound)
+	}
+	if _, err := Resolve(store, []string{prefix + "../secret#00"}); err != ErrNotFound {
+		t.Errorf("Resolve() of ../secret error = %v, want %v", err, ErrNotFound)
+	}
+	if err := store.Put("../secret", []byte("x"), -1); err == nil {
+		t.Error("Put(../secret) succeeded")
+	}
+	if b, err := os.ReadFile(secret); err != nil || string(b) != "01234567secret" {
+		t.Errorf("file outside the store is changed: %q, %v", b, err)
+	}
+}
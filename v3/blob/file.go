@@ -0,0 +1,124 @@
+package blob
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 每个blob一个文件，前8字节是过期时间(unix秒，0表示不过期)
+const headerSize = 8
+
+// FileStore
+// blobs are kept in dir, expired blobs are removed on Get and by a periodic purge on Put.
+// Servers and clients need to share the dir (e.g. a network file system).
+type FileStore struct {
+	dir       string
+	lock      sync.Mutex
+	lastPurge time.Time
+}
+
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{dir: dir}
+}
+
+// path key是Offload生成的uuid，其它的key（如 ../）会访问dir之外的文件，不允许使用
+func (s *FileStore) path(key string) (string, bool) {
+	if _, err := uuid.Parse(key); err != nil || len(key) != len(uuid.Nil.String()) {
+		return "", false
+	}
+	return filepath.Join(s.dir, key), true
+}
+
+// Put 先写临时文件再rename，读取时不会看到写了一半的数据
+func (s *FileStore) Put(key string, data []byte, exTime int) error {
+	p, ok := s.path(key)
+	if !ok {
+		return errors.New("Task: invalid blob key " + key)
+	}
+	if err := os.MkdirAll(s.dir, os.FileMode(0700)); err != nil {
+		return err
+	}
+	s.purge()
+	var header = make([]byte, headerSize)
+	if exTime > 0 {
+		binary.BigEndian.PutUint64(header, uint64(time.Now().Add(time.Duration(exTime)*time.Second).Unix()))
+	}
+	f, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(append(header, data...))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, p)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+func (s *FileStore) Get(key string) ([]byte, error) {
+	p, ok := s.path(key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if len(b) < headerSize || isExpired(b[:headerSize]) {
+		os.Remove(p)
+		return nil, ErrNotFound
+	}
+	return b[headerSize:], nil
+}
+
+func isExpired(header []byte) bool {
+	exAt := int64(binary.BigEndian.Uint64(header))
+	return exAt > 0 && exAt < time.Now().Unix()
+}
+
+// purge 每分钟最多清理一次过期的blob
+func (s *FileStore) purge() {
+	s.lock.Lock()
+	if time.Since(s.lastPurge) < time.Minute {
+		s.lock.Unlock()
+		return
+	}
+	s.lastPurge = time.Now()
+	s.lock.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	var header = make([]byte, headerSize)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		p := filepath.Join(s.dir, e.Name())
+		f, err := os.Open(p)
+		if err != nil {
+			continue
+		}
+		n, _ := f.Read(header)
+		f.Close()
+		if n == headerSize && isExpired(header) {
+			os.Remove(p)
+		}
+	}
+}
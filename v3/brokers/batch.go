@@ -0,0 +1,56 @@
+package brokers
+
+import (
+	"github.com/eopenio/itask/v3/message"
+	"github.com/eopenio/itask/v3/util/compress"
+)
+
+// marshalBatch 序列化失败的消息记录在errs中，index为values对应的消息下标
+func marshalBatch(c compress.Compressor, msgs []message.Message) (values [][]byte, index []int, errs []error) {
+	errs = make([]error, len(msgs))
+	for i, msg := range msgs {
+		b, err := c.Marshal(msg)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		values = append(values, b)
+		index = append(index, i)
+	}
+	return
+}
+
+// unmarshalBatch 跳过无法解析的消息，全部无法解析时返回第一个错误
+func unmarshalBatch(values [][]byte) ([]message.Message, error) {
+	msgs := make([]message.Message, 0, len(values))
+	var firstErr error
+	for _, b := range values {
+		var msg message.Message
+		if err := compress.Unmarshal(b, &msg); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) == 0 {
+		return nil, firstErr
+	}
+	return msgs, nil
+}
+
+// batchErrors 把发送values时的错误填到对应的消息上，全部成功时返回nil
+func batchErrors(errs []error, index []int, err error) []error {
+	if err != nil {
+		for _, i := range index {
+			errs[i] = err
+		}
+	}
+	for _, e := range errs {
+		if e != nil {
+			return errs
+		}
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package brokers
 
 import (
+	"time"
+
 	"github.com/eopenio/itask/v3/message"
 )
 
@@ -13,3 +15,75 @@ type BrokerInterface interface {
 	GetPoolSize() int
 	Clone() BrokerInterface
 }
+
+// AckBrokerInterface
+// broker with at-least-once delivery.
+// Next only leases the message, it must be confirmed by Ack or released by Nack,
+// otherwise it is put back to the queue by Requeue once the visibility timeout has passed.
+type AckBrokerInterface interface {
+	BrokerInterface
+	// Ack remove the leased message from the broker
+	Ack(queueName string, msg message.Message) error
+	// Nack release the lease and put the message back to the head of the queue
+	Nack(queueName string, msg message.Message) error
+	// Touch extend the lease of a running message
+	Touch(queueName string, msg message.Message) error
+	// Requeue put the messages with expired lease back to the queue, return the number of messages
+	Requeue(queueName string) (int, error)
+	SetVisibilityTimeout(time.Duration)
+	GetVisibilityTimeout() time.Duration
+}
+
+// PriorityBrokerInterface
+// broker that can wait on several queues at once, queueNames are checked in order
+// so the first queue has the highest priority
+type PriorityBrokerInterface interface {
+	BrokerInterface
+	NextFrom(queueNames ...string) (message.Message, error)
+}
+
+// DelayBrokerInterface
+// broker that keeps delayed messages itself sorted by run time, instead of cycling them through DelayServer
+type DelayBrokerInterface interface {
+	BrokerInterface
+	// Schedule save msg, it will be moved to queueName at runAt
+	Schedule(queueName string, msg message.Message, runAt time.Time) error
+	// MoveDue atomically move at most limit due messages to queueName, return the number of moved messages
+	MoveDue(queueName string, limit int) (int, error)
+}
+
+// InspectBrokerInterface
+// broker that can look into a queue without consuming it, used by the dead letter queue
+type InspectBrokerInterface interface {
+	BrokerInterface
+	Len(queueName string) (int, error)
+	// Range return messages from start to stop (inclusive), stop=-1 means the last one
+	Range(queueName string, start int, stop int) ([]message.Message, error)
+	// Remove remove the message with id from the queue and return it
+	Remove(queueName string, id string) (message.Message, error)
+	Purge(queueName string) error
+}
+
+// RemoveBatchBrokerInterface
+// InspectBrokerInterface that removes many messages in one scan of the queue, used by ReplayAllDeadLetters
+type RemoveBatchBrokerInterface interface {
+	InspectBrokerInterface
+	// RemoveBatch remove the messages with ids and return them in queue order, ids not in the queue are skipped
+	RemoveBatch(queueName string, ids []string) ([]message.Message, error)
+}
+
+// BatchBrokerInterface
+// broker that can send many messages to one queue in a single round trip
+type BatchBrokerInterface interface {
+	BrokerInterface
+	// SendBatch return nil if all messages are sent, otherwise errs[i] is the error of msgs[i]
+	SendBatch(queueName string, msgs []message.Message) []error
+}
+
+// PrefetchBrokerInterface
+// broker that can take several messages in one round trip, used by the server to fill its prefetch buffer
+type PrefetchBrokerInterface interface {
+	BrokerInterface
+	// NextN return at most n messages without waiting, ierrors.ErrEmptyQueue if the queue is empty
+	NextN(queueName string, n int) ([]message.Message, error)
+}
@@ -4,21 +4,43 @@ import (
 	"github.com/eopenio/itask/v3/drive"
 	"github.com/eopenio/itask/v3/ierrors"
 	"github.com/eopenio/itask/v3/message"
-	"github.com/eopenio/itask/v3/util/yjson"
+	"github.com/eopenio/itask/v3/util/compress"
 )
 
 // LocalBroker
-// ！！！只用于本地测试！！！
-// !!! Only for local test !!!
+// file based broker for a single machine, messages are kept in dir and survive restarts.
+// Processes using the same dir share the queues.
 type LocalBroker struct {
-	client drive.LocalDrive
+	client     drive.LocalDrive
+	dir        string
+	compressor compress.Compressor
 }
 
+// NewLocalBroker 数据保存在系统临时目录
 func NewLocalBroker() LocalBroker {
 	return LocalBroker{}
 }
+
+func NewLocalBrokerWithDir(dir string) LocalBroker {
+	return LocalBroker{dir: dir}
+}
+
+// SetCompressor 消息超过阈值时压缩，读取时总是自动解压
+func (l *LocalBroker) SetCompressor(c compress.Compressor) {
+	l.compressor = c
+}
+
 func (l *LocalBroker) Activate() {
-	l.client = drive.NewLocalDrive(true)
+	if l.dir == "" {
+		l.client = drive.NewLocalDrive(true)
+		return
+	}
+	// Activate不能返回错误，dir不可用时与NewLocalDrive一样panic
+	client, err := drive.NewLocalDriveWithDir(l.dir, true)
+	if err != nil {
+		panic("Task: activate local broker error: " + err.Error())
+	}
+	l.client = client
 }
 func (l *LocalBroker) Next(queueName string) (message.Message, error) {
 	var msg message.Message
@@ -29,12 +51,36 @@ func (l *LocalBroker) Next(queueName string) (message.Message, error) {
 		}
 		return msg, err
 	}
-	err = yjson.TaskJson.Unmarshal(b, &msg)
+	err = compress.Unmarshal(b, &msg)
 	return msg, err
 }
 
+func (l *LocalBroker) NextFrom(queueNames ...string) (message.Message, error) {
+	var msg message.Message
+	b, err := l.client.LPopFirst(queueNames...)
+	if err != nil {
+		if err == drive.EmptyQueueError {
+			return msg, ierrors.ErrEmptyQueue{}
+		}
+		return msg, err
+	}
+	err = compress.Unmarshal(b, &msg)
+	return msg, err
+}
+
+func (l *LocalBroker) NextN(queueName string, n int) ([]message.Message, error) {
+	values, err := l.client.LPopN(queueName, n)
+	if err != nil {
+		if err == drive.EmptyQueueError {
+			return nil, ierrors.ErrEmptyQueue{}
+		}
+		return nil, err
+	}
+	return unmarshalBatch(values)
+}
+
 func (l *LocalBroker) Send(queueName string, msg message.Message) error {
-	b, err := yjson.TaskJson.Marshal(msg)
+	b, err := l.compressor.Marshal(msg)
 
 	if err != nil {
 		return err
@@ -43,8 +89,18 @@ func (l *LocalBroker) Send(queueName string, msg message.Message) error {
 	return err
 }
 
+// SendBatch 所有消息在一次写入中完成
+func (l *LocalBroker) SendBatch(queueName string, msgs []message.Message) []error {
+	values, index, errs := marshalBatch(l.compressor, msgs)
+	var err error
+	if len(values) > 0 {
+		err = l.client.RPush(queueName, values...)
+	}
+	return batchErrors(errs, index, err)
+}
+
 func (l *LocalBroker) LSend(queueName string, msg message.Message) error {
-	b, err := yjson.TaskJson.Marshal(msg)
+	b, err := l.compressor.Marshal(msg)
 
 	if err != nil {
 		return err
@@ -53,6 +109,44 @@ func (l *LocalBroker) LSend(queueName string, msg message.Message) error {
 	return err
 }
 
+func (l *LocalBroker) Len(queueName string) (int, error) {
+	return l.client.LLen(queueName)
+}
+
+func (l *LocalBroker) Range(queueName string, start int, stop int) ([]message.Message, error) {
+	values, err := l.client.LRange(queueName, start, stop)
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]message.Message, len(values))
+	for i, b := range values {
+		if err = compress.Unmarshal(b, &msgs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return msgs, nil
+}
+
+func (l *LocalBroker) Remove(queueName string, id string) (message.Message, error) {
+	var msg message.Message
+	b, err := l.client.LRemove(queueName, func(b []byte) bool {
+		var m message.Message
+		return compress.Unmarshal(b, &m) == nil && m.Id == id
+	})
+	if err != nil {
+		if err == drive.NilResultError {
+			return msg, ierrors.ErrNotFound{Id: id}
+		}
+		return msg, err
+	}
+	err = compress.Unmarshal(b, &msg)
+	return msg, err
+}
+
+func (l *LocalBroker) Purge(queueName string) error {
+	return l.client.Del(queueName)
+}
+
 func (l *LocalBroker) SetPoolSize(i int) {
 
 }
@@ -62,5 +156,5 @@ func (l *LocalBroker) GetPoolSize() int {
 }
 
 func (l *LocalBroker) Clone() BrokerInterface {
-	return &LocalBroker{}
+	return &LocalBroker{dir: l.dir, compressor: l.compressor}
 }
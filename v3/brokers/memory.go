@@ -0,0 +1,143 @@
+package brokers
+
+import (
+	"time"
+
+	"github.com/eopenio/itask/v3/drive"
+	"github.com/eopenio/itask/v3/ierrors"
+	"github.com/eopenio/itask/v3/message"
+	"github.com/eopenio/itask/v3/util/compress"
+)
+
+// MemoryBroker
+// in-process broker. Queues are kept in memory and shared by all clones,
+// so a Server and the Client got from it use the same queues. Messages are lost when the process exits.
+type MemoryBroker struct {
+	client     *drive.MemoryDrive
+	compressor compress.Compressor
+}
+
+func NewMemoryBroker() MemoryBroker {
+	return MemoryBroker{client: drive.NewMemoryDrive()}
+}
+
+// SetCompressor 消息超过阈值时压缩，读取时总是自动解压
+func (l *MemoryBroker) SetCompressor(c compress.Compressor) {
+	l.compressor = c
+}
+
+func (l *MemoryBroker) Activate() {
+}
+
+func (l *MemoryBroker) Next(queueName string) (message.Message, error) {
+	return l.NextFrom(queueName)
+}
+
+func (l *MemoryBroker) NextFrom(queueNames ...string) (message.Message, error) {
+	var msg message.Message
+	b, err := l.client.LPopFirst(2*time.Second, queueNames...)
+	if err != nil {
+		if err == drive.EmptyQueueError {
+			return msg, ierrors.ErrEmptyQueue{}
+		}
+		return msg, err
+	}
+	err = compress.Unmarshal(b, &msg)
+	return msg, err
+}
+
+func (l *MemoryBroker) NextN(queueName string, n int) ([]message.Message, error) {
+	values, err := l.client.LPopN(queueName, n)
+	if err != nil {
+		if err == drive.EmptyQueueError {
+			return nil, ierrors.ErrEmptyQueue{}
+		}
+		return nil, err
+	}
+	return unmarshalBatch(values)
+}
+
+func (l *MemoryBroker) Send(queueName string, msg message.Message) error {
+	b, err := l.compressor.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return l.client.RPush(queueName, b)
+}
+
+// SendBatch 所有消息在一次写入中完成
+func (l *MemoryBroker) SendBatch(queueName string, msgs []message.Message) []error {
+	values, index, errs := marshalBatch(l.compressor, msgs)
+	var err error
+	if len(values) > 0 {
+		err = l.client.RPush(queueName, values...)
+	}
+	return batchErrors(errs, index, err)
+}
+
+func (l *MemoryBroker) LSend(queueName string, msg message.Message) error {
+	b, err := l.compressor.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return l.client.LPush(queueName, b)
+}
+
+func (l *MemoryBroker) Schedule(queueName string, msg message.Message, runAt time.Time) error {
+	b, err := l.compressor.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	l.client.ZAdd(queueName, b, runAt)
+	return nil
+}
+
+func (l *MemoryBroker) MoveDue(queueName string, limit int) (int, error) {
+	return l.client.MoveDue(queueName, limit), nil
+}
+
+func (l *MemoryBroker) Len(queueName string) (int, error) {
+	return l.client.LLen(queueName), nil
+}
+
+func (l *MemoryBroker) Range(queueName string, start int, stop int) ([]message.Message, error) {
+	values := l.client.LRange(queueName, start, stop)
+	msgs := make([]message.Message, len(values))
+	for i, b := range values {
+		if err := compress.Unmarshal(b, &msgs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return msgs, nil
+}
+
+func (l *MemoryBroker) Remove(queueName string, id string) (message.Message, error) {
+	var msg message.Message
+	b, err := l.client.LRemove(queueName, func(b []byte) bool {
+		var m message.Message
+		return compress.Unmarshal(b, &m) == nil && m.Id == id
+	})
+	if err != nil {
+		return msg, ierrors.ErrNotFound{Id: id}
+	}
+	err = compress.Unmarshal(b, &msg)
+	return msg, err
+}
+
+func (l *MemoryBroker) Purge(queueName string) error {
+	l.client.Del(queueName)
+	return nil
+}
+
+func (l *MemoryBroker) SetPoolSize(i int) {
+
+}
+
+func (l *MemoryBroker) GetPoolSize() int {
+	return 0
+}
+
+// Clone 共享同一个内存队列
+func (l *MemoryBroker) Clone() BrokerInterface {
+	return &MemoryBroker{client: l.client, compressor: l.compressor}
+}
@@ -0,0 +1,52 @@
+package brokers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/eopenio/itask/v3/message"
+	"github.com/eopenio/itask/v3/util/compress"
+)
+
+func newTestMessage(arg string) message.Message {
+	msg := message.NewMessage(message.NewMsgArgs())
+	msg.WorkerName = "w"
+	msg.SetArgs(arg)
+	return msg
+}
+
+// Send和SendBatch保存的消息格式一致，Next和NextN都能读取
+func TestMemoryBrokerSendBatch(t *testing.T) {
+	for _, c := range []compress.Compressor{{}, compress.NewCompressor(compress.Gzip, 64)} {
+		b := NewMemoryBroker()
+		b.SetCompressor(c)
+		var broker BrokerInterface = b.Clone()
+
+		sent := []message.Message{newTestMessage("first"), newTestMessage(strings.Repeat("x", 1024)), newTestMessage("third")}
+		if err := broker.Send("q", sent[0]); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+		if errs := b.SendBatch("q", sent[1:]); errs != nil {
+			t.Fatalf("SendBatch() errors = %v", errs)
+		}
+
+		first, err := broker.Next("q")
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		rest, err := b.NextN("q", 10)
+		if err != nil {
+			t.Fatalf("NextN() error = %v", err)
+		}
+		got := append([]message.Message{first}, rest...)
+		if len(got) != len(sent) {
+			t.Fatalf("got %d messages, want %d", len(got), len(sent))
+		}
+		for i := range sent {
+			if got[i].Id != sent[i].Id || got[i].FuncArgs[0] != sent[i].FuncArgs[0] {
+				t.Errorf("message %d with compressor %+v = %s %.10q, want %s %.10q",
+					i, c, got[i].Id, got[i].FuncArgs, sent[i].Id, sent[i].FuncArgs)
+			}
+		}
+	}
+}
@@ -2,10 +2,19 @@ package config
 
 import (
 	"github.com/eopenio/itask/v3/backends"
+	"github.com/eopenio/itask/v3/blob"
 	"github.com/eopenio/itask/v3/brokers"
 	"github.com/eopenio/itask/v3/log"
+	"github.com/eopenio/itask/v3/message"
+	"github.com/eopenio/itask/v3/util/codec"
+	"github.com/eopenio/itask/v3/util/envelope"
 )
 
+// MaxPriorityLevels
+// task priorities are clamped to [0, MaxPriorityLevels-1]. A client doesn't know the PriorityLevels of the servers,
+// so the top priority of a server also reads the queues of the priorities above it
+const MaxPriorityLevels = 8
+
 type Config struct {
 	// require: true
 	Broker brokers.BrokerInterface
@@ -32,6 +41,85 @@ type Config struct {
 
 	EnableDelayServer    bool
 	DelayServerQueueSize int
+
+	// require: false
+	// default: 5 min
+	// only used by brokers.AckBrokerInterface, un-acked messages are put back to the queue after ex seconds
+	VisibilityTimeout int
+
+	// require: false
+	// default: false
+	// copy the message to the dead letter queue when the task finished with a status in DeadLetterStatus
+	EnableDeadLetter bool
+	// default: [message.ResultStatus.Failure, message.ResultStatus.Timeout]
+	DeadLetterStatus []int
+
+	// require: false
+	// default: 1
+	// number of priority queues per group read by servers, at most MaxPriorityLevels,
+	// tasks with a priority >= PriorityLevels run with the top priority
+	PriorityLevels int
+	// require: false
+	// default: 0, disabled
+	// a lower priority queue is checked first after being passed over PriorityAging times, avoid starvation
+	PriorityAging int
+
+	// require: false
+	// default: 0, disabled
+	// number of messages a server takes from the broker at once and keeps in a local buffer,
+	// only used by brokers.PrefetchBrokerInterface. GroupPrefetch overrides it for some groups
+	Prefetch      int
+	GroupPrefetch map[string]int
+
+	// require: false
+	// default: nil, disabled
+	// encrypt task args and results with AES-GCM envelope encryption, keys are got from KeyProvider by key id
+	KeyProvider envelope.KeyProvider
+
+	// require: false
+	// default: nil, disabled
+	// producers sign messages with HMAC-SHA256, servers verify them according to VerifyMode
+	SignKeyProvider envelope.KeyProvider
+	// default: SignatureVerifyMode.None
+	// GroupVerifyMode overrides it for some groups
+	VerifyMode      int
+	GroupVerifyMode map[string]int
+
+	// require: false
+	// default: codec.JSON
+	// codec used by clients to encode task args, servers encode results with the codec of the message
+	// and decode values of any registered codec.
+	// messages and results are still JSON, values of other codecs are saved as base64 strings in them,
+	// so a codec keeps the types of the values (e.g. proto.Message) but doesn't make []byte cheaper than JSON
+	Codec codec.Codec
+
+	// require: false
+	// default: nil, disabled
+	// task args and results longer than BlobThreshold bytes are saved in BlobStore,
+	// messages and results only carry a reference. blobs expire after ResultExpires,
+	// blobs of args expire ResultExpires after the run time of the task, and are renewed when it is retried or rescheduled
+	BlobStore     blob.StoreInterface
+	BlobThreshold int
+
+	// require: false
+	// default: 1s
+	// servers check whether running tasks are aborted every AbortCheckInterval seconds, <=0:disabled.
+	// backends.AbortBackendInterface pushes abort signals at once, the checks still catch signals lost on reconnecting
+	AbortCheckInterval int
+}
+
+type signatureVerifyModeChoice struct {
+	None       int
+	Permissive int
+	Reject     int
+	Quarantine int
+}
+
+var SignatureVerifyMode = signatureVerifyModeChoice{
+	None:       0, // 不验证
+	Permissive: 1, // 验证失败时只记录日志，仍然执行，用于迁移
+	Reject:     2, // 验证失败时丢弃消息
+	Quarantine: 3, // 验证失败时放入隔离队列
 }
 
 func (c Config) Clone() Config {
@@ -44,6 +132,31 @@ func (c Config) Clone() Config {
 		ResultExpires:        c.ResultExpires,
 		EnableDelayServer:    c.EnableDelayServer,
 		DelayServerQueueSize: c.DelayServerQueueSize,
+		VisibilityTimeout:    c.VisibilityTimeout,
+		EnableDeadLetter:     c.EnableDeadLetter,
+		DeadLetterStatus:     append([]int(nil), c.DeadLetterStatus...),
+		PriorityLevels:       c.PriorityLevels,
+		PriorityAging:        c.PriorityAging,
+		Prefetch:             c.Prefetch,
+		KeyProvider:          c.KeyProvider,
+		SignKeyProvider:      c.SignKeyProvider,
+		VerifyMode:           c.VerifyMode,
+		Codec:                c.Codec,
+		BlobStore:            c.BlobStore,
+		BlobThreshold:        c.BlobThreshold,
+		AbortCheckInterval:   c.AbortCheckInterval,
+	}
+	if c.GroupPrefetch != nil {
+		newC.GroupPrefetch = make(map[string]int, len(c.GroupPrefetch))
+		for k, v := range c.GroupPrefetch {
+			newC.GroupPrefetch[k] = v
+		}
+	}
+	if c.GroupVerifyMode != nil {
+		newC.GroupVerifyMode = make(map[string]int, len(c.GroupVerifyMode))
+		for k, v := range c.GroupVerifyMode {
+			newC.GroupVerifyMode[k] = v
+		}
 	}
 	if c.Backend != nil {
 		newC.Backend = c.Backend.Clone()
@@ -61,6 +174,10 @@ func NewConfig(setConfigFunc ...SetConfigFunc) Config {
 		StatusExpires:        60 * 60 * 24,
 		ResultExpires:        60 * 60 * 24,
 		DelayServerQueueSize: 20,
+		VisibilityTimeout:    60 * 5,
+		DeadLetterStatus:     []int{message.ResultStatus.Failure, message.ResultStatus.Timeout},
+		PriorityLevels:       1,
+		AbortCheckInterval:   1,
 		Logger:               log.NewTaskLogger(log.TaskLog),
 	}
 	for _, f := range setConfigFunc {
@@ -115,3 +232,135 @@ func ResultExpires(ex int) SetConfigFunc {
 		config.ResultExpires = ex
 	}
 }
+
+func VisibilityTimeout(ex int) SetConfigFunc {
+	return func(config *Config) {
+		config.VisibilityTimeout = ex
+	}
+}
+
+// EnableDeadLetter
+//   - status: result status that should be copied to the dead letter queue, default: Failure, Timeout
+func EnableDeadLetter(enable bool, status ...int) SetConfigFunc {
+	return func(config *Config) {
+		config.EnableDeadLetter = enable
+		if len(status) > 0 {
+			config.DeadLetterStatus = status
+		}
+	}
+}
+
+// Priority
+//   - levels: number of priority queues per group
+//   - aging: check a lower priority queue first after it is passed over aging times, 0:disabled
+func Priority(levels int, aging int) SetConfigFunc {
+	return func(config *Config) {
+		config.PriorityLevels = levels
+		config.PriorityAging = aging
+	}
+}
+
+// Prefetch
+//   - count: number of messages taken from the broker at once, <=1:disabled
+//   - groupNames: only set for these groups, empty means all groups
+func Prefetch(count int, groupNames ...string) SetConfigFunc {
+	return func(config *Config) {
+		if len(groupNames) == 0 {
+			config.Prefetch = count
+			return
+		}
+		if config.GroupPrefetch == nil {
+			config.GroupPrefetch = make(map[string]int)
+		}
+		for _, groupName := range groupNames {
+			config.GroupPrefetch[groupName] = count
+		}
+	}
+}
+
+// GetPriorityLevels PriorityLevels 限制在 [1, MaxPriorityLevels]
+func (c Config) GetPriorityLevels() int {
+	if c.PriorityLevels < 1 {
+		return 1
+	}
+	if c.PriorityLevels > MaxPriorityLevels {
+		return MaxPriorityLevels
+	}
+	return c.PriorityLevels
+}
+
+// GetPrefetch prefetch count of groupName
+func (c Config) GetPrefetch(groupName string) int {
+	if n, ok := c.GroupPrefetch[groupName]; ok {
+		return n
+	}
+	return c.Prefetch
+}
+
+// Encryption
+//   - p: provider of the keys, nil:disabled
+func Encryption(p envelope.KeyProvider) SetConfigFunc {
+	return func(config *Config) {
+		config.KeyProvider = p
+	}
+}
+
+// Signature
+//   - p: provider of the HMAC keys, nil:disabled
+func Signature(p envelope.KeyProvider) SetConfigFunc {
+	return func(config *Config) {
+		config.SignKeyProvider = p
+	}
+}
+
+// VerifySignature
+//   - mode: SignatureVerifyMode
+//   - groupNames: only set for these groups, empty means all groups
+func VerifySignature(mode int, groupNames ...string) SetConfigFunc {
+	return func(config *Config) {
+		if len(groupNames) == 0 {
+			config.VerifyMode = mode
+			return
+		}
+		if config.GroupVerifyMode == nil {
+			config.GroupVerifyMode = make(map[string]int)
+		}
+		for _, groupName := range groupNames {
+			config.GroupVerifyMode[groupName] = mode
+		}
+	}
+}
+
+// GetVerifyMode signature verify mode of groupName
+func (c Config) GetVerifyMode(groupName string) int {
+	if mode, ok := c.GroupVerifyMode[groupName]; ok {
+		return mode
+	}
+	return c.VerifyMode
+}
+
+// Codec
+//   - c: codec.JSON, codec.MsgPack, codec.Protobuf or a registered custom codec, nil:JSON
+func Codec(c codec.Codec) SetConfigFunc {
+	return func(config *Config) {
+		config.Codec = c
+	}
+}
+
+// ClaimCheck
+//   - store: blob.NewFileStore, blob.NewBackendStore or a custom store, nil:disabled
+//   - threshold: args or results longer than threshold bytes are saved in store
+func ClaimCheck(store blob.StoreInterface, threshold int) SetConfigFunc {
+	return func(config *Config) {
+		config.BlobStore = store
+		config.BlobThreshold = threshold
+	}
+}
+
+// AbortCheckInterval
+//   - ex: seconds, <=0:disabled
+func AbortCheckInterval(ex int) SetConfigFunc {
+	return func(config *Config) {
+		config.AbortCheckInterval = ex
+	}
+}
@@ -0,0 +1,44 @@
+package drive
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// TokenBuckets
+// in-process token buckets, safe for concurrent use
+type TokenBuckets struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func NewTokenBuckets() *TokenBuckets {
+	return &TokenBuckets{buckets: make(map[string]*bucket)}
+}
+
+// Take 取一个令牌，成功时返回0，否则返回需要等待的时间
+//   - rate: 每秒生成的令牌数
+//   - burst: 桶的容量
+func (b *TokenBuckets) Take(key string, rate float64, burst int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	bk, ok := b.buckets[key]
+	if !ok {
+		bk = &bucket{tokens: float64(burst), last: now}
+		b.buckets[key] = bk
+	}
+	bk.tokens = math.Min(float64(burst), bk.tokens+now.Sub(bk.last).Seconds()*rate)
+	bk.last = now
+	if bk.tokens >= 1 {
+		bk.tokens -= 1
+		return 0
+	}
+	return time.Duration(math.Ceil((1 - bk.tokens) / rate * float64(time.Second)))
+}
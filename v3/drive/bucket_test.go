@@ -0,0 +1,37 @@
+package drive
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucketsBurst(t *testing.T) {
+	b := NewTokenBuckets()
+	for i := 0; i < 3; i++ {
+		if wait := b.Take("k", 1, 3); wait != 0 {
+			t.Fatalf("Take() %d of burst 3 waits %s", i+1, wait)
+		}
+	}
+	wait := b.Take("k", 1, 3)
+	// 取令牌花费的时间会补充一点令牌
+	if wait <= 900*time.Millisecond || wait > time.Second {
+		t.Errorf("Take() of an empty bucket waits %s, want about 1s", wait)
+	}
+	// 其它key不受影响
+	if wait = b.Take("other", 1, 3); wait != 0 {
+		t.Errorf("Take() of another key waits %s", wait)
+	}
+}
+
+func TestTokenBucketsRefill(t *testing.T) {
+	b := NewTokenBuckets()
+	b.Take("k", 100, 1)
+	wait := b.Take("k", 100, 1)
+	if wait == 0 || wait > 10*time.Millisecond {
+		t.Fatalf("Take() of an empty bucket waits %s, want about 10ms", wait)
+	}
+	time.Sleep(wait)
+	if w := b.Take("k", 100, 1); w != 0 {
+		t.Errorf("Take() after %s waits %s", wait, w)
+	}
+}
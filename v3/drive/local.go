@@ -1,8 +1,10 @@
 package drive
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"time"
@@ -18,92 +20,145 @@ type backendItem struct {
 }
 type backendStruct map[string]backendItem
 
+// LocalDrive
+// file based drive, data is kept in a json file under dir and survives restarts.
+// Every operation holds an OS file lock, so several processes can share the same dir,
+// different dirs are fully isolated.
 type LocalDrive struct {
-	brokerLock  UnsafeFileLock
-	backendLock UnsafeFileLock
-	brokerPath  string
-	backendPath string
-	isBroker    bool
+	lock     FileLock
+	path     string
+	isBroker bool
 }
 
+// NewLocalDrive 数据保存在系统临时目录，初始化失败时panic
 func NewLocalDrive(isBroker bool) LocalDrive {
-	var d = LocalDrive{}
+	d, err := NewLocalDriveWithDir(os.TempDir(), isBroker)
+	if err != nil {
+		panic("Task: init local drive error: " + err.Error())
+	}
+	return d
+}
+
+// NewLocalDriveWithDir 返回dir无法创建、无法加锁等初始化错误
+func NewLocalDriveWithDir(dir string, isBroker bool) (LocalDrive, error) {
+	var d = LocalDrive{isBroker: isBroker}
 	if isBroker {
-		d.isBroker = true
-		d.brokerLock = NewFileLock("Task_local_broker.lock")
-		d.brokerPath = filepath.Join(os.TempDir(), "Task_local_broker.json")
+		d.lock = NewFileLock(filepath.Join(dir, "Task_local_broker.lock"))
+		d.path = filepath.Join(dir, "Task_local_broker.json")
 	} else {
-		d.backendLock = NewFileLock("Task_local_backend.lock")
-		d.backendPath = filepath.Join(os.TempDir(), "Task_local_backend.json")
+		d.lock = NewFileLock(filepath.Join(dir, "Task_local_backend.lock"))
+		d.path = filepath.Join(dir, "Task_local_backend.json")
 	}
 
-	d.Init()
-	return d
+	return d, d.Init()
 }
 
-func (d LocalDrive) Init() {
-	if d.isBroker {
-		d.brokerLock.Init()
-		os.WriteFile(d.brokerPath, []byte("{}"), os.FileMode(0600))
-
-	} else {
-		d.backendLock.Init()
-		os.WriteFile(d.backendPath, []byte("{}"), os.FileMode(0600))
+// Init 创建目录，清理上次崩溃残留的临时文件，不会清空已有数据
+func (d LocalDrive) Init() error {
+	if err := os.MkdirAll(filepath.Dir(d.path), os.FileMode(0700)); err != nil {
+		return err
 	}
+	f, err := d.lock.Lock()
+	if err != nil {
+		return err
+	}
+	defer d.lock.Unlock(f)
+	tmpFiles, _ := filepath.Glob(d.path + ".tmp-*")
+	for _, tmp := range tmpFiles {
+		os.Remove(tmp)
+	}
+	return nil
 }
+
+// Close 数据文件保留，下次打开继续使用
 func (d LocalDrive) Close() {
-	d.brokerLock.Unlock()
-	d.backendLock.Unlock()
-	os.Remove(d.brokerPath)
-	os.Remove(d.backendPath)
 }
 
-func (d LocalDrive) getBrokerData() brokerStruct {
-	var data brokerStruct
-	b, _ := os.ReadFile(d.brokerPath)
-	json.Unmarshal(b, &data)
-	return data
+// load 文件不存在视为空；无法解析时（如被外部截断）返回错误，不覆盖原有数据，需要人工处理
+func (d LocalDrive) load(v interface{}) error {
+	b, err := os.ReadFile(d.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if len(b) == 0 {
+		return nil
+	}
+	if err = json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("Task: decode local drive file %s error: %w", d.path, err)
+	}
+	return nil
 }
-func (d LocalDrive) setBrokerData(data brokerStruct) {
-	b, _ := json.Marshal(data)
-	os.WriteFile(d.brokerPath, b, os.FileMode(0600))
+
+// save 先写临时文件并fsync，再rename覆盖，保证数据文件要么是旧的要么是新的
+func (d LocalDrive) save(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(d.path), filepath.Base(d.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, d.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
 }
 
-func (d LocalDrive) getBackendData() backendStruct {
-	var data backendStruct
-	b, _ := os.ReadFile(d.backendPath)
-	json.Unmarshal(b, &data)
-	return data
+func (d LocalDrive) getBrokerData() (brokerStruct, error) {
+	var data = brokerStruct{}
+	err := d.load(&data)
+	return data, err
 }
 
-func (d LocalDrive) setBackendData(data backendStruct) {
-	b, _ := json.Marshal(data)
-	os.WriteFile(d.backendPath, b, os.FileMode(0600))
+func (d LocalDrive) getBackendData() (backendStruct, error) {
+	var data = backendStruct{}
+	err := d.load(&data)
+	return data, err
 }
 
 func (d LocalDrive) Set(key string, value []byte, exTime int) error {
-	err := d.backendLock.Lock()
+	f, err := d.lock.Lock()
 	if err != nil {
 		return err
 	}
-	defer d.backendLock.Unlock()
+	defer d.lock.Unlock(f)
 	var t = time.Time{}
 	if exTime > 0 {
 		t = time.Now().Add(time.Duration(exTime) * time.Second)
 	}
-	data := d.getBackendData()
+	data, err := d.getBackendData()
+	if err != nil {
+		return err
+	}
 	data[key] = backendItem{value, t}
-	d.setBackendData(data)
-	return nil
+	return d.save(data)
 }
 
 func (d LocalDrive) Get(key string) ([]byte, error) {
-	err := d.backendLock.Lock()
+	f, err := d.lock.Lock()
+	if err != nil {
+		return nil, err
+	}
+	defer d.lock.Unlock(f)
+	data, err := d.getBackendData()
 	if err != nil {
 		return nil, err
 	}
-	defer d.backendLock.Unlock()
-	data := d.getBackendData()
 	r, ok := data[key]
 	if !ok {
 		return nil, NilResultError
@@ -114,58 +169,182 @@ func (d LocalDrive) Get(key string) ([]byte, error) {
 	return r.Data, nil
 }
 
-func (d LocalDrive) push(queueName string, value []byte, isRight bool) error {
-	err := d.brokerLock.Lock()
+// SetNX key不存在或已过期时保存value，返回 (value, true)；否则返回已有的值和false
+func (d LocalDrive) SetNX(key string, value []byte, exTime int) ([]byte, bool, error) {
+	f, err := d.lock.Lock()
+	if err != nil {
+		return nil, false, err
+	}
+	defer d.lock.Unlock(f)
+	data, err := d.getBackendData()
+	if err != nil {
+		return nil, false, err
+	}
+	if r, ok := data[key]; ok && (r.ExTime.IsZero() || r.ExTime.After(time.Now())) {
+		return r.Data, false, nil
+	}
+	var t = time.Time{}
+	if exTime > 0 {
+		t = time.Now().Add(time.Duration(exTime) * time.Second)
+	}
+	data[key] = backendItem{value, t}
+	return value, true, d.save(data)
+}
+
+// DelIfEqual key的值是value时才删除
+func (d LocalDrive) DelIfEqual(key string, value []byte) error {
+	f, err := d.lock.Lock()
+	if err != nil {
+		return err
+	}
+	defer d.lock.Unlock(f)
+	data, err := d.getBackendData()
+	if err != nil {
+		return err
+	}
+	if r, ok := data[key]; !ok || !bytes.Equal(r.Data, value) {
+		return nil
+	}
+	delete(data, key)
+	return d.save(data)
+}
+
+func (d LocalDrive) DelKey(key string) error {
+	f, err := d.lock.Lock()
+	if err != nil {
+		return err
+	}
+	defer d.lock.Unlock(f)
+	data, err := d.getBackendData()
+	if err != nil {
+		return err
+	}
+	if _, ok := data[key]; !ok {
+		return nil
+	}
+	delete(data, key)
+	return d.save(data)
+}
+
+// ExpireIfEqual key的值是value时重新设置过期时间
+func (d LocalDrive) ExpireIfEqual(key string, value []byte, exTime int) (bool, error) {
+	f, err := d.lock.Lock()
+	if err != nil {
+		return false, err
+	}
+	defer d.lock.Unlock(f)
+	data, err := d.getBackendData()
+	if err != nil {
+		return false, err
+	}
+	r, ok := data[key]
+	if !ok || !bytes.Equal(r.Data, value) || (!r.ExTime.IsZero() && r.ExTime.Before(time.Now())) {
+		return false, nil
+	}
+	r.ExTime = time.Time{}
+	if exTime > 0 {
+		r.ExTime = time.Now().Add(time.Duration(exTime) * time.Second)
+	}
+	data[key] = r
+	return true, d.save(data)
+}
+
+func (d LocalDrive) push(queueName string, isRight bool, values ...[]byte) error {
+	f, err := d.lock.Lock()
+	if err != nil {
+		return err
+	}
+	defer d.lock.Unlock(f)
+	data, err := d.getBrokerData()
 	if err != nil {
 		return err
 	}
-	defer d.brokerLock.Unlock()
-	data := d.getBrokerData()
 	item, _ := data[queueName]
 	if isRight {
-		item.Msg = rPush(item.Msg, value)
+		item.Msg = rPush(item.Msg, values...)
 	} else {
-		item.Msg = lPush(item.Msg, value)
+		for _, value := range values {
+			item.Msg = lPush(item.Msg, value)
+		}
 	}
 	data[queueName] = item
-	d.setBrokerData(data)
-	return nil
+	return d.save(data)
 }
 
-func (d LocalDrive) RPush(queueName string, value []byte) error {
-	return d.push(queueName, value, true)
+// RPush 多个元素在一次写入中完成
+func (d LocalDrive) RPush(queueName string, values ...[]byte) error {
+	return d.push(queueName, true, values...)
 }
 
 func (d LocalDrive) LPush(queueName string, value []byte) error {
-	return d.push(queueName, value, false)
+	return d.push(queueName, false, value)
 }
 
-func (d LocalDrive) lPop(queueName string) ([]byte, error) {
-	err := d.brokerLock.Lock()
+// lPop 按顺序从第一个非空队列中取出元素
+func (d LocalDrive) lPop(queueNames ...string) ([]byte, error) {
+	f, err := d.lock.Lock()
 	if err != nil {
 		return nil, err
 	}
-	defer d.brokerLock.Unlock()
-	data := d.getBrokerData()
-	item, ok := data[queueName]
-	if !ok {
-		return nil, EmptyQueueError
+	defer d.lock.Unlock(f)
+	data, err := d.getBrokerData()
+	if err != nil {
+		return nil, err
+	}
+	for _, queueName := range queueNames {
+		item, ok := data[queueName]
+		if !ok {
+			continue
+		}
+		b, msg := lPop(item.Msg)
+		if b == nil {
+			continue
+		}
+		item.Msg = msg
+		data[queueName] = item
+		if err = d.save(data); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+	return nil, EmptyQueueError
+}
+
+// LPopN 取出最多n个元素，不等待
+func (d LocalDrive) LPopN(queueName string, n int) ([][]byte, error) {
+	f, err := d.lock.Lock()
+	if err != nil {
+		return nil, err
 	}
-	b, msg := lPop(item.Msg)
-	if b == nil {
+	defer d.lock.Unlock(f)
+	data, err := d.getBrokerData()
+	if err != nil {
+		return nil, err
+	}
+	item := data[queueName]
+	values, msg := lPopN(item.Msg, n)
+	if len(values) == 0 {
 		return nil, EmptyQueueError
 	}
 	item.Msg = msg
 	data[queueName] = item
-	d.setBrokerData(data)
-	return b, nil
+	if err = d.save(data); err != nil {
+		return nil, err
+	}
+	return values, nil
 }
 
 func (d LocalDrive) LPop(queueName string) ([]byte, error) {
+	return d.LPopFirst(queueName)
+}
+
+// LPopFirst 按顺序从第一个非空队列中取出元素，用于优先级队列
+func (d LocalDrive) LPopFirst(queueNames ...string) ([]byte, error) {
 	// 由于会有多个协程执行这个操作，这里超时时间短一点，尽快让出锁
-	ctx, _ := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
 	for {
-		b, err := d.lPop(queueName)
+		b, err := d.lPop(queueNames...)
 		if err == nil {
 			return b, nil
 		}
@@ -176,3 +355,72 @@ func (d LocalDrive) LPop(queueName string) ([]byte, error) {
 		}
 	}
 }
+
+func (d LocalDrive) LLen(queueName string) (int, error) {
+	f, err := d.lock.Lock()
+	if err != nil {
+		return 0, err
+	}
+	defer d.lock.Unlock(f)
+	data, err := d.getBrokerData()
+	if err != nil {
+		return 0, err
+	}
+	return len(data[queueName].Msg), nil
+}
+
+// LRange stop=-1 表示到最后一个
+func (d LocalDrive) LRange(queueName string, start int, stop int) ([][]byte, error) {
+	f, err := d.lock.Lock()
+	if err != nil {
+		return nil, err
+	}
+	defer d.lock.Unlock(f)
+	data, err := d.getBrokerData()
+	if err != nil {
+		return nil, err
+	}
+	return lRange(data[queueName].Msg, start, stop), nil
+}
+
+// LRemove 删除第一个match的元素并返回
+func (d LocalDrive) LRemove(queueName string, match func([]byte) bool) ([]byte, error) {
+	f, err := d.lock.Lock()
+	if err != nil {
+		return nil, err
+	}
+	defer d.lock.Unlock(f)
+	data, err := d.getBrokerData()
+	if err != nil {
+		return nil, err
+	}
+	item, ok := data[queueName]
+	if !ok {
+		return nil, NilResultError
+	}
+	for i, b := range item.Msg {
+		if match(b) {
+			item.Msg = append(item.Msg[:i:i], item.Msg[i+1:]...)
+			data[queueName] = item
+			if err = d.save(data); err != nil {
+				return nil, err
+			}
+			return b, nil
+		}
+	}
+	return nil, NilResultError
+}
+
+func (d LocalDrive) Del(queueName string) error {
+	f, err := d.lock.Lock()
+	if err != nil {
+		return err
+	}
+	defer d.lock.Unlock(f)
+	data, err := d.getBrokerData()
+	if err != nil {
+		return err
+	}
+	delete(data, queueName)
+	return d.save(data)
+}
@@ -0,0 +1,58 @@
+package drive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalDrivePersist(t *testing.T) {
+	dir := t.TempDir()
+	d, err := NewLocalDriveWithDir(dir, true)
+	if err != nil {
+		t.Fatalf("NewLocalDriveWithDir() error = %v", err)
+	}
+	if err = d.RPush("q", []byte("a"), []byte("b")); err != nil {
+		t.Fatalf("RPush() error = %v", err)
+	}
+
+	// 重新打开同一个目录，数据还在；其它目录互不影响
+	reopened, _ := NewLocalDriveWithDir(dir, true)
+	if b, err := reopened.LPop("q"); err != nil || string(b) != "a" {
+		t.Errorf("LPop() after reopen = %q, %v, want a", b, err)
+	}
+	other, _ := NewLocalDriveWithDir(t.TempDir(), true)
+	if _, err := other.LPop("q"); err != EmptyQueueError {
+		t.Errorf("LPop() of another dir error = %v, want %v", err, EmptyQueueError)
+	}
+}
+
+func TestLocalDriveCorruptFile(t *testing.T) {
+	dir := t.TempDir()
+	d, err := NewLocalDriveWithDir(dir, false)
+	if err != nil {
+		t.Fatalf("NewLocalDriveWithDir() error = %v", err)
+	}
+	if err = os.WriteFile(d.path, []byte(`{"k":`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Get("k"); err == nil {
+		t.Error("Get() of a corrupt file succeeded")
+	}
+	if err = d.Set("k", []byte("v"), 0); err == nil {
+		t.Error("Set() overwrote a corrupt file")
+	}
+	if b, _ := os.ReadFile(d.path); string(b) != `{"k":` {
+		t.Errorf("corrupt file is changed to %q", b)
+	}
+}
+
+func TestNewLocalDriveWithDirError(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewLocalDriveWithDir(file, true); err == nil {
+		t.Error("NewLocalDriveWithDir() of a regular file succeeded")
+	}
+}
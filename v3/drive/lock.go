@@ -1,39 +1,34 @@
 package drive
 
 import (
-	"context"
-	"errors"
 	"os"
-	"path/filepath"
-	"time"
 )
 
-type UnsafeFileLock struct {
+// FileLock
+// exclusive lock on a file, held by the OS (flock / LockFileEx).
+// It works between processes and between goroutines of one process, and is released if the process dies.
+type FileLock struct {
 	filePath string
 }
 
-func NewFileLock(s string) UnsafeFileLock {
-	return UnsafeFileLock{filepath.Join(os.TempDir(), s)}
+func NewFileLock(filePath string) FileLock {
+	return FileLock{filePath}
 }
-func (l UnsafeFileLock) Init() {
-	os.Remove(l.filePath)
-}
-func (l UnsafeFileLock) Lock() error {
-	ctx, _ := context.WithTimeout(context.Background(), time.Millisecond*400)
-	for {
-		f, err := os.OpenFile(l.filePath, os.O_CREATE|os.O_EXCL, os.FileMode(0600))
-		if err == nil {
-			f.Close()
-			return nil
-		}
-		select {
-		case <-ctx.Done():
-			return errors.New("lock timeout")
-		case <-time.After(100 * time.Millisecond):
-		}
+
+// Lock 阻塞直到获取锁，返回的文件要传给Unlock
+func (l FileLock) Lock() (*os.File, error) {
+	f, err := os.OpenFile(l.filePath, os.O_CREATE|os.O_RDWR, os.FileMode(0600))
+	if err != nil {
+		return nil, err
+	}
+	if err = lockFile(f); err != nil {
+		f.Close()
+		return nil, err
 	}
+	return f, nil
 }
 
-func (l UnsafeFileLock) Unlock() {
-	os.Remove(l.filePath)
+func (l FileLock) Unlock(f *os.File) {
+	unlockFile(f)
+	f.Close()
 }
@@ -0,0 +1,279 @@
+package drive
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"time"
+)
+
+type delayedItem struct {
+	Data  []byte
+	RunAt time.Time
+}
+
+// MemoryDrive
+// in-process storage for MemoryBroker and MemoryBackend, safe for concurrent use.
+// LPopFirst waits on a channel that is closed on every push, so it never polls.
+type MemoryDrive struct {
+	mu          sync.Mutex
+	queues      map[string][][]byte
+	delayed     map[string][]delayedItem // 按RunAt排序
+	notify      chan struct{}
+	data        map[string]backendItem
+	lastCleanup time.Time
+	subs        map[string]map[int]func([]byte) // [channel][id]subscriber
+	nextSubId   int
+
+	Buckets *TokenBuckets
+}
+
+func NewMemoryDrive() *MemoryDrive {
+	return &MemoryDrive{
+		queues:  make(map[string][][]byte),
+		delayed: make(map[string][]delayedItem),
+		notify:  make(chan struct{}),
+		data:    make(map[string]backendItem),
+		subs:    make(map[string]map[int]func([]byte)),
+		Buckets: NewTokenBuckets(),
+	}
+}
+
+// wakeUp 通知所有等待中的LPopFirst，调用前必须加锁
+func (d *MemoryDrive) wakeUp() {
+	close(d.notify)
+	d.notify = make(chan struct{})
+}
+
+func (d *MemoryDrive) RPush(queueName string, values ...[]byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.queues[queueName] = rPush(d.queues[queueName], values...)
+	d.wakeUp()
+	return nil
+}
+
+func (d *MemoryDrive) LPush(queueName string, value []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.queues[queueName] = lPush(d.queues[queueName], value)
+	d.wakeUp()
+	return nil
+}
+
+// LPopFirst 按顺序从第一个非空队列中取出元素，都为空时最多等待timeout
+func (d *MemoryDrive) LPopFirst(timeout time.Duration, queueNames ...string) ([]byte, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		d.mu.Lock()
+		for _, queueName := range queueNames {
+			b, l := lPop(d.queues[queueName])
+			if b != nil {
+				d.queues[queueName] = l
+				d.mu.Unlock()
+				return b, nil
+			}
+		}
+		notify := d.notify
+		d.mu.Unlock()
+
+		select {
+		case <-notify:
+		case <-timer.C:
+			return nil, EmptyQueueError
+		}
+	}
+}
+
+// LPopN 取出最多n个元素，不等待
+func (d *MemoryDrive) LPopN(queueName string, n int) ([][]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	values, l := lPopN(d.queues[queueName], n)
+	if len(values) == 0 {
+		return nil, EmptyQueueError
+	}
+	d.queues[queueName] = l
+	return values, nil
+}
+
+func (d *MemoryDrive) LLen(queueName string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.queues[queueName])
+}
+
+// LRange stop=-1 表示到最后一个
+func (d *MemoryDrive) LRange(queueName string, start int, stop int) [][]byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([][]byte(nil), lRange(d.queues[queueName], start, stop)...)
+}
+
+// LRemove 删除第一个match的元素并返回
+func (d *MemoryDrive) LRemove(queueName string, match func([]byte) bool) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	l := d.queues[queueName]
+	for i, b := range l {
+		if match(b) {
+			d.queues[queueName] = append(l[:i:i], l[i+1:]...)
+			return b, nil
+		}
+	}
+	return nil, NilResultError
+}
+
+func (d *MemoryDrive) Del(queueName string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.queues, queueName)
+}
+
+// ZAdd 保存延时元素，到runAt之后由MoveDue放入队列
+func (d *MemoryDrive) ZAdd(queueName string, value []byte, runAt time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	l := d.delayed[queueName]
+	i := sort.Search(len(l), func(i int) bool { return l[i].RunAt.After(runAt) })
+	l = append(l, delayedItem{})
+	copy(l[i+1:], l[i:])
+	l[i] = delayedItem{Data: value, RunAt: runAt}
+	d.delayed[queueName] = l
+}
+
+// MoveDue 把最多limit个到时间的延时元素放入队列，返回移动的数量
+func (d *MemoryDrive) MoveDue(queueName string, limit int) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	l := d.delayed[queueName]
+	n := 0
+	now := time.Now()
+	for n < len(l) && n < limit && !l[n].RunAt.After(now) {
+		d.queues[queueName] = rPush(d.queues[queueName], l[n].Data)
+		n++
+	}
+	if n > 0 {
+		d.delayed[queueName] = l[n:]
+		d.wakeUp()
+	}
+	return n
+}
+
+// Set exTime<=0 不过期
+func (d *MemoryDrive) Set(key string, value []byte, exTime int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var t = time.Time{}
+	if exTime > 0 {
+		t = time.Now().Add(time.Duration(exTime) * time.Second)
+	}
+	d.data[key] = backendItem{value, t}
+	d.cleanup()
+}
+
+func (d *MemoryDrive) Get(key string) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	r, ok := d.data[key]
+	if !ok {
+		return nil, NilResultError
+	}
+	if !r.ExTime.IsZero() && r.ExTime.Before(time.Now()) {
+		delete(d.data, key)
+		return nil, NilResultError
+	}
+	return r.Data, nil
+}
+
+// SetNX key不存在或已过期时保存value，返回 (value, true)；否则返回已有的值和false
+func (d *MemoryDrive) SetNX(key string, value []byte, exTime int) ([]byte, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if r, ok := d.data[key]; ok && (r.ExTime.IsZero() || r.ExTime.After(time.Now())) {
+		return r.Data, false
+	}
+	var t = time.Time{}
+	if exTime > 0 {
+		t = time.Now().Add(time.Duration(exTime) * time.Second)
+	}
+	d.data[key] = backendItem{value, t}
+	d.cleanup()
+	return value, true
+}
+
+// DelIfEqual key的值是value时才删除
+func (d *MemoryDrive) DelIfEqual(key string, value []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if r, ok := d.data[key]; ok && bytes.Equal(r.Data, value) {
+		delete(d.data, key)
+	}
+}
+
+func (d *MemoryDrive) DelKey(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.data, key)
+}
+
+// ExpireIfEqual key的值是value时重新设置过期时间
+func (d *MemoryDrive) ExpireIfEqual(key string, value []byte, exTime int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	r, ok := d.data[key]
+	if !ok || !bytes.Equal(r.Data, value) || (!r.ExTime.IsZero() && r.ExTime.Before(time.Now())) {
+		return false
+	}
+	r.ExTime = time.Time{}
+	if exTime > 0 {
+		r.ExTime = time.Now().Add(time.Duration(exTime) * time.Second)
+	}
+	d.data[key] = r
+	return true
+}
+
+// cleanup 每分钟最多一次，删除过期的数据，调用前必须加锁
+func (d *MemoryDrive) cleanup() {
+	now := time.Now()
+	if now.Sub(d.lastCleanup) < time.Minute {
+		return
+	}
+	d.lastCleanup = now
+	for k, v := range d.data {
+		if !v.ExTime.IsZero() && v.ExTime.Before(now) {
+			delete(d.data, k)
+		}
+	}
+}
+
+// Publish 同步调用channel的所有订阅者
+func (d *MemoryDrive) Publish(channel string, payload []byte) {
+	d.mu.Lock()
+	fs := make([]func([]byte), 0, len(d.subs[channel]))
+	for _, f := range d.subs[channel] {
+		fs = append(fs, f)
+	}
+	d.mu.Unlock()
+	for _, f := range fs {
+		f(payload)
+	}
+}
+
+// Subscribe 返回取消订阅的函数
+func (d *MemoryDrive) Subscribe(channel string, f func([]byte)) func() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	id := d.nextSubId
+	d.nextSubId++
+	if d.subs[channel] == nil {
+		d.subs[channel] = make(map[int]func([]byte))
+	}
+	d.subs[channel][id] = f
+	return func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		delete(d.subs[channel], id)
+	}
+}
@@ -1,7 +1,7 @@
 package drive
 
-func rPush(l [][]byte, v []byte) [][]byte {
-	return append(l, v)
+func rPush(l [][]byte, v ...[]byte) [][]byte {
+	return append(l, v...)
 }
 func lPop(l [][]byte) ([]byte, [][]byte) {
 	if len(l) == 0 {
@@ -10,9 +10,30 @@ func lPop(l [][]byte) ([]byte, [][]byte) {
 	return l[0], l[1:]
 }
 
+// lPopN 取出前n个元素
+func lPopN(l [][]byte, n int) ([][]byte, [][]byte) {
+	if n > len(l) {
+		n = len(l)
+	}
+	return l[:n:n], l[n:]
+}
+
 func lPush(l [][]byte, v []byte) [][]byte {
 	var n = make([][]byte, len(l)+1)
 	copy(n[1:], l)
 	n[0] = v
 	return n
 }
+
+func lRange(l [][]byte, start int, stop int) [][]byte {
+	if stop < 0 || stop >= len(l) {
+		stop = len(l) - 1
+	}
+	if start < 0 {
+		start = 0
+	}
+	if start > stop {
+		return nil
+	}
+	return l[start : stop+1]
+}
@@ -5,12 +5,16 @@ go 1.18
 require (
 	github.com/google/uuid v1.6.0
 	github.com/json-iterator/go v1.1.12
+	github.com/klauspost/compress v1.17.7
 	github.com/sirupsen/logrus v1.9.3
+	github.com/vmihailenco/msgpack/v5 v5.3.5
 	golang.org/x/sync v0.6.0
+	golang.org/x/sys v0.18.0
+	google.golang.org/protobuf v1.33.0
 )
 
 require (
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
 	github.com/modern-go/reflect2 v1.0.2 // indirect
-	golang.org/x/sys v0.18.0 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
 )
@@ -1,7 +1,9 @@
 package ierrors
 
 import (
+	"errors"
 	"fmt"
+	"time"
 )
 
 const (
@@ -14,6 +16,15 @@ const (
 	ErrTypeSendMsg         = 7 // 通过broker发送消息失败，目前工作流发送下一个任务时会用到
 	ErrTypeNilBackend      = 8
 	ErrTypeAbortTask       = 9
+	ErrTypeUnsupportedOp   = 10 // broker,backend 不支持此操作
+	ErrTypeNotFound        = 11 // 队列中没有找到消息
+	ErrTypeBatch           = 12 // 批量发送时部分消息失败
+	ErrTypeDecrypt         = 13 // 任务参数或结果解密失败
+	ErrTypeSignature       = 14 // 消息没有签名或签名错误
+	ErrTypeLockBusy        = 15 // 任务的锁被其他任务持有
+	ErrTypePermanent       = 16 // 任务失败且不再重试
+	ErrTypeRetryAfter      = 17 // 任务失败，指定时间后重试
+	ErrTypeTaskTimeout     = 18 // 任务运行超时
 )
 
 func IsEqual(err error, errType int) bool {
@@ -132,3 +143,168 @@ func (e ErrAbortTask) Error() string {
 func (e ErrAbortTask) Type() int {
 	return ErrTypeAbortTask
 }
+
+type ErrUnsupportedOp struct {
+	Op string
+}
+
+func (e ErrUnsupportedOp) Error() string {
+	return fmt.Sprintf("Task: unsupported operation [%s]", e.Op)
+}
+
+func (e ErrUnsupportedOp) Type() int {
+	return ErrTypeUnsupportedOp
+}
+
+type ErrNotFound struct {
+	Id string
+}
+
+func (e ErrNotFound) Error() string {
+	return fmt.Sprintf("Task: not found [%s]", e.Id)
+}
+
+func (e ErrNotFound) Type() int {
+	return ErrTypeNotFound
+}
+
+// ErrBatch
+// Errs[i] is the error of the i-th message, nil if it is sent
+type ErrBatch struct {
+	Errs []error
+}
+
+func (e ErrBatch) Error() string {
+	var n int
+	var first error
+	for _, err := range e.Errs {
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			n++
+		}
+	}
+	return fmt.Sprintf("Task: %d of %d messages failed, first error: %v", n, len(e.Errs), first)
+}
+
+func (e ErrBatch) Type() int {
+	return ErrTypeBatch
+}
+
+type ErrDecrypt struct {
+	Msg string
+}
+
+func (e ErrDecrypt) Error() string {
+	return fmt.Sprintf("Task: decrypt error: %s", e.Msg)
+}
+
+func (e ErrDecrypt) Type() int {
+	return ErrTypeDecrypt
+}
+
+type ErrSignature struct {
+	Msg string
+}
+
+func (e ErrSignature) Error() string {
+	return fmt.Sprintf("Task: signature error: %s", e.Msg)
+}
+
+func (e ErrSignature) Type() int {
+	return ErrTypeSignature
+}
+
+type ErrLockBusy struct {
+	Name string
+}
+
+func (e ErrLockBusy) Error() string {
+	return fmt.Sprintf("Task: lock [%s] is held by another task", e.Name)
+}
+
+func (e ErrLockBusy) Type() int {
+	return ErrTypeLockBusy
+}
+
+// ErrPermanent
+// the task fails at once with status Failure, even if it can retry.
+// Error() is the error of Err, so Result.Err keeps the reason
+type ErrPermanent struct {
+	Err error
+}
+
+func (e ErrPermanent) Error() string {
+	return e.Err.Error()
+}
+
+func (e ErrPermanent) Type() int {
+	return ErrTypePermanent
+}
+
+func (e ErrPermanent) Unwrap() error {
+	return e.Err
+}
+
+// Permanent wrap err so the task doesn't retry, e.g. ctl.Retry(ierrors.Permanent(err)) for invalid args
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return ErrPermanent{Err: err}
+}
+
+// ErrRetryAfter
+// the task retries after Delay instead of the backoff of the worker, if it can retry
+type ErrRetryAfter struct {
+	Err   error
+	Delay time.Duration
+}
+
+func (e ErrRetryAfter) Error() string {
+	return e.Err.Error()
+}
+
+func (e ErrRetryAfter) Type() int {
+	return ErrTypeRetryAfter
+}
+
+func (e ErrRetryAfter) Unwrap() error {
+	return e.Err
+}
+
+// RetryAfter wrap err so the task retries after d, e.g. when a service returns 429 with Retry-After
+func RetryAfter(err error, d time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return ErrRetryAfter{Err: err, Delay: d}
+}
+
+// IsPermanent err 或其包装的错误中有 ErrPermanent
+func IsPermanent(err error) bool {
+	var e ErrPermanent
+	return errors.As(err, &e)
+}
+
+// GetRetryAfter return: delay of the first ErrRetryAfter in the chain of err
+func GetRetryAfter(err error) (time.Duration, bool) {
+	var e ErrRetryAfter
+	if errors.As(err, &e) {
+		return e.Delay, true
+	}
+	return 0, false
+}
+
+type ErrTaskTimeout struct {
+	Timeout time.Duration
+}
+
+func (e ErrTaskTimeout) Error() string {
+	return fmt.Sprintf("Task: task timeout after %s", e.Timeout)
+}
+
+func (e ErrTaskTimeout) Type() int {
+	return ErrTypeTaskTimeout
+}
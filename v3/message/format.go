@@ -0,0 +1,61 @@
+package message
+
+import (
+	"github.com/eopenio/itask/v3/util/yjson"
+)
+
+/*
+消息和结果的格式版本
+
+  - 没有版本号(0)：v2 的消息，MsgArgs 的字段名为 TaskCtl；或加入版本号之前的v3消息
+  - FormatV3：当前格式
+
+读取时旧格式会被升级为当前格式；比当前版本新的格式只读取已知字段并保留版本号，
+消息不会因为解码失败被丢弃。滚动升级时先升级worker，再升级生产者
+*/
+const (
+	FormatLegacy  = 0
+	FormatV3      = 3
+	FormatVersion = FormatV3
+)
+
+// 没有方法的别名，避免 UnmarshalJSON 递归
+type messageFormat Message
+type resultFormat Result
+
+// v2 的消息
+type messageV2 struct {
+	TaskCtl *MessageArgs
+}
+
+// UnmarshalJSON 把旧格式的消息升级为当前格式，比当前版本新的消息只读取已知字段
+func (m *Message) UnmarshalJSON(b []byte) error {
+	if err := yjson.TaskJson.Unmarshal(b, (*messageFormat)(m)); err != nil {
+		return err
+	}
+	switch {
+	case m.Version == FormatLegacy:
+		var v2 messageV2
+		if err := yjson.TaskJson.Unmarshal(b, &v2); err != nil {
+			return err
+		}
+		if v2.TaskCtl != nil {
+			m.MsgArgs = *v2.TaskCtl
+		}
+	case m.Version > FormatVersion:
+		return nil
+	}
+	m.Version = FormatVersion
+	return nil
+}
+
+// UnmarshalJSON v2 与v3的结果字段相同，只需要升级版本号，比当前版本新的结果只读取已知字段
+func (r *Result) UnmarshalJSON(b []byte) error {
+	if err := yjson.TaskJson.Unmarshal(b, (*resultFormat)(r)); err != nil {
+		return err
+	}
+	if r.Version < FormatVersion {
+		r.Version = FormatVersion
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/eopenio/itask/v3/util/yjson"
+)
+
+func TestMessageUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       string
+		retryCount int
+		priority   int
+		version    int
+	}{
+		{
+			name:       "v2 TaskCtl",
+			data:       `{"Id":"1","WorkerName":"w","FuncArgs":["1"],"TaskCtl":{"RetryCount":2,"Priority":1}}`,
+			retryCount: 2,
+			priority:   1,
+			version:    FormatVersion,
+		},
+		{
+			name:       "v3 without version",
+			data:       `{"Id":"1","WorkerName":"w","FuncArgs":["1"],"MsgArgs":{"RetryCount":5}}`,
+			retryCount: 5,
+			version:    FormatVersion,
+		},
+		{
+			name:       "current version",
+			data:       `{"Id":"1","WorkerName":"w","FuncArgs":["1"],"MsgArgs":{"RetryCount":1,"Priority":2},"Version":3}`,
+			retryCount: 1,
+			priority:   2,
+			version:    FormatVersion,
+		},
+		{
+			name:       "newer version keeps known fields",
+			data:       `{"Id":"1","WorkerName":"w","FuncArgs":["1"],"MsgArgs":{"RetryCount":4},"NewField":true,"Version":99}`,
+			retryCount: 4,
+			version:    99,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m Message
+			if err := yjson.TaskJson.Unmarshal([]byte(tt.data), &m); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if m.Id != "1" || m.WorkerName != "w" || len(m.FuncArgs) != 1 || m.FuncArgs[0] != "1" {
+				t.Errorf("Unmarshal() = %+v, fields are lost", m)
+			}
+			if m.MsgArgs.RetryCount != tt.retryCount || m.MsgArgs.Priority != tt.priority {
+				t.Errorf("MsgArgs = %+v, want RetryCount %d Priority %d", m.MsgArgs, tt.retryCount, tt.priority)
+			}
+			if m.Version != tt.version {
+				t.Errorf("Version = %d, want %d", m.Version, tt.version)
+			}
+		})
+	}
+}
+
+func TestResultUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		version int
+	}{
+		{"without version", `{"Id":"1","Status":4}`, FormatVersion},
+		{"current version", `{"Id":"1","Status":4,"Version":3}`, FormatVersion},
+		{"newer version", `{"Id":"1","Status":4,"Version":99}`, 99},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r Result
+			if err := yjson.TaskJson.Unmarshal([]byte(tt.data), &r); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if r.Id != "1" || r.Status != ResultStatus.Success {
+				t.Errorf("Unmarshal() = %+v, fields are lost", r)
+			}
+			if r.Version != tt.version {
+				t.Errorf("Version = %d, want %d", r.Version, tt.version)
+			}
+		})
+	}
+}
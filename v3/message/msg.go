@@ -1,7 +1,8 @@
 package message
 
 import (
-	"github.com/eopenio/itask/v3/util"
+	"github.com/eopenio/itask/v3/util/codec"
+	"github.com/eopenio/itask/v3/util/yjson"
 	"github.com/google/uuid"
 	"time"
 )
@@ -11,12 +12,47 @@ type Message struct {
 	WorkerName string      `json:"worker_name"`
 	FuncArgs   []string    `json:"func_args"`
 	MsgArgs    MessageArgs `v2JsonName:"TaskCtl"` // 为了方便client端send时通过SetTaskCtl修改相关参数
+
+	// 编码FuncArgs的codec，空表示JSON，server用同一个codec编码结果
+	Codec string `json:"codec,omitempty"`
+
+	// 只有死信队列中的消息才有
+	DeadLetter *DeadLetterInfo `json:"dead_letter,omitempty"`
+
+	// 生产者的签名，覆盖 Id, WorkerName, FuncArgs, MsgArgs, Codec, Version
+	Signature *MessageSignature `json:"signature,omitempty"`
+
+	// 格式版本，读取时旧版本的消息会被升级，见 FormatVersion
+	Version int `json:"version"`
+
+	// AckBroker 给每次投递的标识，Ack/Nack/Touch 用它找到这次投递的租约。
+	// 同一个任务可能被重新发送（重试、延后）并在原来的消息确认前再次被取到，所以不能用Id，不序列化
+	Delivery string `yjson:"-"`
+}
+
+type MessageSignature struct {
+	KeyId string
+	Sig   string
+}
+
+// DeadLetterInfo 消息进入死信队列的原因
+type DeadLetterInfo struct {
+	GroupName string    // 原来的group
+	Status    int       // 任务最终状态, ResultStatus
+	Err       string    // 最后一次的错误信息
+	Attempts  int       // 运行次数
+	Time      time.Time // 进入死信队列的时间
 }
 
 type MessageArgs struct {
 	RetryCount int
+	Priority   int                   // 优先级，越大越先执行，0为默认优先级
 	RunTime    time.Time             // 指定任务延后多长时间执行
 	ExpireTime time.Time             // 指定任务过期时间
+	Locks      []string              // 运行前需要获取的分布式锁
+	Attempts   int                   // 已经运行的次数，重试的任务重新投递时加1
+	Backoff    *RetryBackoff         // 重试间隔，nil时使用worker的设置
+	Timeout    time.Duration         // 每次运行的超时时间，0时使用worker的设置
 	Workflow   []MessageWorkflowArgs `json:"workflow"`
 }
 
@@ -24,6 +60,7 @@ type MessageWorkflowArgs struct {
 	GroupName  string
 	WorkerName string
 	RetryCount int
+	Priority   int
 	RunAfter   time.Duration
 	RunAt      time.Time
 	ExpireTime time.Time
@@ -38,11 +75,37 @@ func NewMessage(msgArgs MessageArgs) Message {
 	return Message{
 		Id:      id,
 		MsgArgs: msgArgs,
+		Version: FormatVersion,
 	}
 }
 
+// LeaseKey 没有Delivery时使用Id
+func (m Message) LeaseKey() string {
+	if m.Delivery != "" {
+		return m.Delivery
+	}
+	return m.Id
+}
+
+// SigningBytes 签名的内容
+func (m Message) SigningBytes() ([]byte, error) {
+	return yjson.TaskJson.Marshal(struct {
+		Id         string
+		WorkerName string
+		FuncArgs   []string
+		MsgArgs    MessageArgs
+		Codec      string
+		Version    int
+	}{m.Id, m.WorkerName, m.FuncArgs, m.MsgArgs, m.Codec, m.Version})
+}
+
+// SetArgs 用m.Codec编码参数
 func (m *Message) SetArgs(args ...interface{}) error {
-	r, err := util.GoVarsToTaskJsonSlice(args...)
+	c, err := codec.Get(m.Codec)
+	if err != nil {
+		return err
+	}
+	r, err := codec.EncodeSlice(c, args...)
 	if err != nil {
 		return err
 	}
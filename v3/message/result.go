@@ -3,7 +3,7 @@ package message
 import (
 	"errors"
 	"fmt"
-	"github.com/eopenio/itask/v3/util/yjson"
+	"github.com/eopenio/itask/v3/util/codec"
 	"strings"
 )
 
@@ -16,6 +16,7 @@ type resultStatusChoice struct {
 	Failure      int
 	Expired      int
 	Abort        int // 手动中止任务
+	Timeout      int // 运行超时
 }
 
 var ResultStatus = resultStatusChoice{
@@ -27,6 +28,7 @@ var ResultStatus = resultStatusChoice{
 	Failure:      5,
 	Expired:      6,
 	Abort:        7, // 手动中止任务
+	Timeout:      8, // 运行超时
 }
 
 type workflowStatusChoice struct {
@@ -36,6 +38,7 @@ type workflowStatusChoice struct {
 	Failure string
 	Expired string
 	Abort   string
+	Timeout string
 }
 
 var WorkflowStatus = workflowStatusChoice{
@@ -45,6 +48,7 @@ var WorkflowStatus = workflowStatusChoice{
 	Failure: "failure",
 	Expired: "expired",
 	Abort:   "abort", // 手动中止任务
+	Timeout: "timeout",
 }
 
 var StatusToWorkflowStatus = map[int]string{
@@ -56,6 +60,7 @@ var StatusToWorkflowStatus = map[int]string{
 	ResultStatus.Failure:      WorkflowStatus.Failure,
 	ResultStatus.Expired:      WorkflowStatus.Expired,
 	ResultStatus.Abort:        WorkflowStatus.Abort,
+	ResultStatus.Timeout:      WorkflowStatus.Timeout,
 }
 
 type Result struct {
@@ -65,11 +70,13 @@ type Result struct {
 	RetryCount int         `json:"retry_count" gorm:"column:retry_count;comment:任务重试次数;type:int;size:10;"`
 	Workflow   [][2]string `json:"workflow" gorm:"-"` // [["workName","status"],] ;  status: waiting , running , success , failure , expired , abort
 	Err        string      `json:"err" gorm:"column:error_msg;comment:错误信息;type:varchar(256);size:50;"`
+	Version    int         `json:"version" gorm:"-"` // 格式版本，见 FormatVersion
 }
 
 func NewResult(id string) Result {
 	return Result{
-		Id: id,
+		Id:      id,
+		Version: FormatVersion,
 	}
 }
 
@@ -94,13 +101,13 @@ func (r *Result) SetStatusRunning() {
 }
 
 func (r Result) Get(index int, v interface{}) error {
-	err := yjson.TaskJson.UnmarshalFromString(r.FuncReturn[index], v)
+	err := codec.Decode(r.FuncReturn[index], v)
 	return err
 }
 
 func (r Result) Gets(args ...interface{}) error {
 	for i, v := range args {
-		err := yjson.TaskJson.UnmarshalFromString(r.FuncReturn[i], v)
+		err := codec.Decode(r.FuncReturn[i], v)
 		if err != nil {
 			return err
 		}
@@ -143,7 +150,7 @@ func (r Result) IsSuccess() bool {
 }
 
 func (r Result) IsFailure() bool {
-	if r.Status == ResultStatus.Failure || r.Status == ResultStatus.Expired || r.Status == ResultStatus.Abort {
+	if r.Status == ResultStatus.Failure || r.Status == ResultStatus.Expired || r.Status == ResultStatus.Abort || r.Status == ResultStatus.Timeout {
 		return true
 	}
 	return false
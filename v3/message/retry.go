@@ -0,0 +1,53 @@
+package message
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryBackoff
+// delay before the n-th retry is Delay * Multiplier^(n-1), capped by MaxDelay
+//   - fixed: Multiplier <= 1
+//   - exponential: Multiplier > 1, e.g. 2
+//   - Jitter: the delay is random in [0, d), so failed tasks don't retry at the same time
+type RetryBackoff struct {
+	Delay      time.Duration
+	Multiplier float64
+	MaxDelay   time.Duration // 0: 不限制
+	Jitter     bool
+}
+
+func FixedBackoff(delay time.Duration) RetryBackoff {
+	return RetryBackoff{Delay: delay}
+}
+
+func ExponentialBackoff(delay time.Duration, maxDelay time.Duration) RetryBackoff {
+	return RetryBackoff{Delay: delay, Multiplier: 2, MaxDelay: maxDelay}
+}
+
+func ExponentialJitterBackoff(delay time.Duration, maxDelay time.Duration) RetryBackoff {
+	return RetryBackoff{Delay: delay, Multiplier: 2, MaxDelay: maxDelay, Jitter: true}
+}
+
+// Next delay before the n-th retry, n starts from 1
+func (b RetryBackoff) Next(n int) time.Duration {
+	if b.Delay <= 0 || n <= 0 {
+		return 0
+	}
+	d := float64(b.Delay)
+	if b.Multiplier > 1 {
+		d *= math.Pow(b.Multiplier, float64(n-1))
+	}
+	if b.MaxDelay > 0 && d > float64(b.MaxDelay) {
+		d = float64(b.MaxDelay)
+	}
+	// 没有MaxDelay时避免溢出
+	if d > math.MaxInt64/2 {
+		d = math.MaxInt64 / 2
+	}
+	if b.Jitter {
+		d = rand.Float64() * d
+	}
+	return time.Duration(d)
+}
@@ -0,0 +1,52 @@
+package message
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRetryBackoffNext(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff RetryBackoff
+		n       int
+		want    time.Duration
+	}{
+		{"zero delay", RetryBackoff{}, 1, 0},
+		{"n is zero", FixedBackoff(time.Second), 0, 0},
+		{"fixed first", FixedBackoff(time.Second), 1, time.Second},
+		{"fixed later", FixedBackoff(time.Second), 5, time.Second},
+		{"exponential first", ExponentialBackoff(time.Second, 0), 1, time.Second},
+		{"exponential third", ExponentialBackoff(time.Second, 0), 3, 4 * time.Second},
+		{"exponential capped", ExponentialBackoff(time.Second, 5*time.Second), 4, 5 * time.Second},
+		{"multiplier 1.5", RetryBackoff{Delay: 2 * time.Second, Multiplier: 1.5}, 3, 4500 * time.Millisecond},
+		{"no overflow", ExponentialBackoff(time.Second, 0), 1000, time.Duration(float64(math.MaxInt64 / 2))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.backoff.Next(tt.n); got != tt.want {
+				t.Errorf("Next(%d) = %s, want %s", tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryBackoffNextJitter(t *testing.T) {
+	b := ExponentialJitterBackoff(time.Second, 10*time.Second)
+	tests := []struct {
+		n   int
+		max time.Duration
+	}{
+		{1, time.Second},
+		{3, 4 * time.Second},
+		{10, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			if got := b.Next(tt.n); got < 0 || got >= tt.max {
+				t.Fatalf("Next(%d) = %s, want in [0, %s)", tt.n, got, tt.max)
+			}
+		}
+	}
+}
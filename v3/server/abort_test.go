@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eopenio/itask/v3/message"
+)
+
+func TestAbortTask(t *testing.T) {
+	s := newMemoryServer()
+	started := make(chan struct{}, 2)
+	var runs int32
+	s.Add("g", "w", func(ctx context.Context) {
+		atomic.AddInt32(&runs, 1)
+		started <- struct{}{}
+		<-ctx.Done()
+	})
+	s.Run("g", 1)
+	defer shutdown(t, s)
+	c := s.GetClient()
+
+	running, _ := c.Send("g", "w")
+	waiting, _ := c.Send("g", "w")
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("task is not started")
+	}
+
+	// 还没运行的任务直接中止，运行中的任务取消context
+	for _, id := range []string{waiting, running} {
+		if err := c.AbortTask(id, 60, "cancelled by user"); err != nil {
+			t.Fatalf("AbortTask() error = %v", err)
+		}
+	}
+	for _, id := range []string{running, waiting} {
+		r, err := c.GetResult(id, 5*time.Second, 20*time.Millisecond)
+		if err != nil || r.Status != message.ResultStatus.Abort {
+			t.Fatalf("task %s: GetResult() = %d, %v, want status %d", id, r.Status, err, message.ResultStatus.Abort)
+		}
+		if !strings.Contains(r.Err, "cancelled by user") {
+			t.Errorf("task %s: Result.Err = %q, want the reason", id, r.Err)
+		}
+	}
+	if n := atomic.LoadInt32(&runs); n != 1 {
+		t.Errorf("%d runs, want 1", n)
+	}
+}
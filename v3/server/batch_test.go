@@ -0,0 +1,39 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/eopenio/itask/v3/ierrors"
+	"github.com/eopenio/itask/v3/message"
+)
+
+func TestSendBatch(t *testing.T) {
+	s := newMemoryServer()
+	s.Add("g", "double", func(n int) int { return n * 2 })
+	s.Run("g", 2)
+	defer shutdown(t, s)
+	c := s.GetClient()
+
+	// 无法编码的参数只影响对应的任务
+	ids, err := c.SendBatch("g", "double", [][]interface{}{{1}, {make(chan int)}, {3}})
+	var batchErr ierrors.ErrBatch
+	if !errors.As(err, &batchErr) || batchErr.Errs[1] == nil || batchErr.Errs[0] != nil || batchErr.Errs[2] != nil {
+		t.Fatalf("SendBatch() error = %v, want an error of the second task only", err)
+	}
+	if ids[1] != "" {
+		t.Errorf("id of the task not sent = %q, want empty", ids[1])
+	}
+
+	for i, want := range map[int]int{0: 2, 2: 6} {
+		r, err := c.GetResult(ids[i], 5*time.Second, 20*time.Millisecond)
+		if err != nil || r.Status != message.ResultStatus.Success {
+			t.Fatalf("task %d: GetResult() = %d, %v", i, r.Status, err)
+		}
+		got, _ := r.GetInt64(0)
+		if got != int64(want) {
+			t.Errorf("task %d returns %d, want %d", i, got, want)
+		}
+	}
+}
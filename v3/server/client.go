@@ -1,9 +1,11 @@
 package server
 
 import (
+	"github.com/eopenio/itask/v3/blob"
 	"github.com/eopenio/itask/v3/config"
 	"github.com/eopenio/itask/v3/ierrors"
 	"github.com/eopenio/itask/v3/message"
+	"strings"
 	"time"
 )
 
@@ -12,6 +14,10 @@ type ctlKeyChoices struct {
 	RunAt      int
 	RunAfter   int
 	ExpireTime int
+	Priority   int
+	Locks      int
+	Backoff    int
+	Timeout    int
 }
 
 var ctlKey = ctlKeyChoices{
@@ -19,6 +25,10 @@ var ctlKey = ctlKeyChoices{
 	RunAt:      1,
 	RunAfter:   2,
 	ExpireTime: 3,
+	Priority:   4,
+	Locks:      5, // string or []string, 任务运行时持有这些锁，见 LockOptions
+	Backoff:    6, // message.RetryBackoff or RetryBackoff, 重试间隔
+	Timeout:    7, // time.Duration, 每次运行的超时时间
 }
 
 type Client struct {
@@ -32,6 +42,10 @@ type Client struct {
 
 func NewClient(c config.Config) Client {
 	su := newServerUtils(c.Broker, c.Backend, c.Logger, c.StatusExpires, c.ResultExpires)
+	su.SetKeyProvider(c.KeyProvider)
+	su.SetSignKeyProvider(c.SignKeyProvider)
+	su.SetCodec(c.Codec)
+	su.SetBlobStore(c.BlobStore, c.BlobThreshold)
 	client := Client{
 		sUtils:        &su,
 		msgArgs:       message.NewMsgArgs(),
@@ -77,6 +91,30 @@ func (c *Client) SetTaskCtl(name int, value interface{}) *Client {
 		cloneC.msgArgs.RunTime = value.(time.Time)
 	case ctlKey.ExpireTime:
 		cloneC.msgArgs.ExpireTime = value.(time.Time)
+	case ctlKey.Priority:
+		// 不按client的 config.PriorityLevels 截断，client与server的配置可能不同，
+		// 超过server优先级数量的任务由server的最高优先级读取，见 config.MaxPriorityLevels
+		cloneC.msgArgs.Priority = value.(int)
+	case ctlKey.Locks:
+		locks := append([]string(nil), cloneC.msgArgs.Locks...)
+		switch v := value.(type) {
+		case string:
+			locks = append(locks, v)
+		case []string:
+			locks = append(locks, v...)
+		}
+		cloneC.msgArgs.Locks = locks
+	case ctlKey.Backoff:
+		var b message.RetryBackoff
+		switch v := value.(type) {
+		case message.RetryBackoff:
+			b = v
+		case RetryBackoff:
+			b = message.RetryBackoff(v)
+		}
+		cloneC.msgArgs.Backoff = &b
+	case ctlKey.Timeout:
+		cloneC.msgArgs.Timeout = value.(time.Duration)
 	}
 	return cloneC
 }
@@ -90,6 +128,54 @@ func (c *Client) Send(groupName string, workerName string, args ...interface{})
 	return c.sUtils.Send(groupName, workerName, c.msgArgs, args...)
 }
 
+// SendUnique
+// send the task only once for the same key within window, e.g. when producers retry on the same business event.
+// The key is recorded atomically in the backend (backends.UniqueBackendInterface), it expires after window.
+// return: taskId (the existing one if the key is already recorded), err
+func (c *Client) SendUnique(key string, window time.Duration, groupName string, workerName string, args ...interface{}) (string, error) {
+	if c.msgArgs.IsDelayMessage() {
+		groupName = c.sUtils.GetDelayGroupName(groupName)
+	}
+	return c.sUtils.SendUnique(key, window, groupName, workerName, c.msgArgs, args...)
+}
+
+// BatchTask
+// one task of Client.SendBatchMixed
+type BatchTask struct {
+	GroupName  string
+	WorkerName string
+	Args       []interface{}
+}
+
+// SendBatch
+// send one task for each args in argsList, tasks of the same queue are sent in one round trip if the broker supports it
+// return: taskIds in the order of argsList ("" if the task is not sent), err is ierrors.ErrBatch if some tasks failed
+func (c *Client) SendBatch(groupName string, workerName string, argsList [][]interface{}) ([]string, error) {
+	tasks := make([]BatchTask, len(argsList))
+	for i, args := range argsList {
+		tasks[i] = BatchTask{GroupName: groupName, WorkerName: workerName, Args: args}
+	}
+	return c.SendBatchMixed(tasks)
+}
+
+// SendBatchMixed
+// like SendBatch, but every task has its own group and worker
+func (c *Client) SendBatchMixed(tasks []BatchTask) ([]string, error) {
+	if c.msgArgs.IsDelayMessage() {
+		delayTasks := make([]BatchTask, len(tasks))
+		for i, task := range tasks {
+			task.GroupName = c.sUtils.GetDelayGroupName(task.GroupName)
+			delayTasks[i] = task
+		}
+		tasks = delayTasks
+	}
+	ids, errs := c.sUtils.SendBatch(tasks, c.msgArgs)
+	if errs != nil {
+		return ids, ierrors.ErrBatch{Errs: errs}
+	}
+	return ids, nil
+}
+
 // Workflow
 // start a workflow
 func (c *Client) Workflow() *ClientWithWorkflow {
@@ -116,6 +202,9 @@ func (c *Client) GetResult(taskId string, timeout time.Duration, sleepTime time.
 		if err == nil && r.IsFinish() {
 			return r, nil
 		}
+		if ierrors.IsEqual(err, ierrors.ErrTypeDecrypt) || isBlobError(err) {
+			return r, err
+		}
 		time.Sleep(sleepTime)
 	}
 }
@@ -133,13 +222,18 @@ func (c *Client) GetAsyncResult(taskId string, timeout time.Duration, sleepTime
 			return message.Result{}, ierrors.ErrTimeOut{}
 		}
 		r, err := c.sUtils.GetResult(taskId)
-		if err == nil {
-			return r, nil
+		if err == nil || ierrors.IsEqual(err, ierrors.ErrTypeDecrypt) || isBlobError(err) {
+			return r, err
 		}
 		time.Sleep(sleepTime)
 	}
 }
 
+// isBlobError 转存的结果已过期或被篡改，不用再等待
+func isBlobError(err error) bool {
+	return err == blob.ErrNotFound || err == blob.ErrChecksum
+}
+
 // GetStatus
 // taskId:
 // timeout:
@@ -153,7 +247,7 @@ func (c *Client) GetStatus(taskId string, timeout time.Duration, sleepTime time.
 		if time.Now().Sub(n) >= timeout {
 			return 0, ierrors.ErrTimeOut{}
 		}
-		r, err := c.sUtils.GetResult(taskId)
+		r, err := c.sUtils.getResult(taskId, false)
 		if err == nil {
 			return r.Status, nil
 		}
@@ -162,10 +256,62 @@ func (c *Client) GetStatus(taskId string, timeout time.Duration, sleepTime time.
 }
 
 // AbortTask
+// tasks not started are aborted before they run, running tasks are aborted by cancelling their context,
+// the final status is Abort and Result.Err records the reason
 //
 //	<exTime>: 过期时间，秒。<=0表示不过期
-func (c *Client) AbortTask(taskID string, exTime int) error {
-	return c.sUtils.AbortTask(taskID, exTime)
+//	<reason>: 中止的原因，可选
+func (c *Client) AbortTask(taskID string, exTime int, reason ...string) error {
+	return c.sUtils.AbortTask(taskID, exTime, strings.Join(reason, " "))
+}
+
+// CountDeadLetters
+// number of messages in the dead letter queue of group
+func (c *Client) CountDeadLetters(groupName string) (int, error) {
+	return c.sUtils.CountDeadLetters(groupName)
+}
+
+// ListDeadLetters
+// list messages in the dead letter queue, message.DeadLetter holds the final error and attempts
+//   - start, stop: index of the queue, stop=-1 means the last one
+func (c *Client) ListDeadLetters(groupName string, start int, stop int) ([]message.Message, error) {
+	return c.sUtils.ListDeadLetters(groupName, start, stop)
+}
+
+// PeekDeadLetter
+// get the dead letter of taskId without removing it
+func (c *Client) PeekDeadLetter(groupName string, taskId string) (message.Message, error) {
+	return c.sUtils.PeekDeadLetter(groupName, taskId)
+}
+
+// ReplayDeadLetter
+// remove the dead letter of taskId and send it to the group again
+func (c *Client) ReplayDeadLetter(groupName string, taskId string) error {
+	return c.sUtils.ReplayDeadLetter(groupName, taskId)
+}
+
+// ReplayAllDeadLetters
+// return: number of replayed messages
+func (c *Client) ReplayAllDeadLetters(groupName string) (int, error) {
+	return c.sUtils.ReplayAllDeadLetters(groupName)
+}
+
+// PurgeDeadLetters
+// delete all messages in the dead letter queue
+func (c *Client) PurgeDeadLetters(groupName string) error {
+	return c.sUtils.PurgeDeadLetters(groupName)
+}
+
+// ListQuarantined
+// list messages that failed signature verification, message.DeadLetter.Err holds the reason
+func (c *Client) ListQuarantined(groupName string, start int, stop int) ([]message.Message, error) {
+	return c.sUtils.ListQuarantined(groupName, start, stop)
+}
+
+// PurgeQuarantined
+// delete all messages in the quarantine queue
+func (c *Client) PurgeQuarantined(groupName string) error {
+	return c.sUtils.PurgeQuarantined(groupName)
 }
 
 type ClientWithWorkflow struct {
@@ -184,6 +330,8 @@ func (c *ClientWithWorkflow) SetTaskCtl(name int, value interface{}) *ClientWith
 		c.WorkflowArgs.ExpireTime = value.(time.Time)
 	case ctlKey.RunAt:
 		c.WorkflowArgs.RunAt = value.(time.Time)
+	case ctlKey.Priority:
+		c.WorkflowArgs.Priority = value.(int)
 	}
 	return c
 }
@@ -209,6 +357,7 @@ func (c *ClientWithWorkflow) Send(groupName string, workerName string, args ...i
 func (c *ClientWithWorkflow) Done() (string, error) {
 	first := c.client.msgArgs.Workflow[0]
 	c.client.SetTaskCtl(ctlKey.RetryCount, first.RetryCount)
+	c.client.SetTaskCtl(ctlKey.Priority, first.Priority)
 	if first.RunAfter != 0 {
 		c.client.SetTaskCtl(ctlKey.RunAfter, first.RunAfter)
 	}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eopenio/itask/v3/config"
+	"github.com/eopenio/itask/v3/message"
+)
+
+func TestConcurrency(t *testing.T) {
+	s := newMemoryServer(config.EnableDelayServer(true))
+	release := make(chan struct{})
+	var running int32
+	s.Add("g", "slow", func() {
+		atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		<-release
+	}, Concurrency{Max: 2, RetryAfter: 100 * time.Millisecond})
+	s.Add("g", "fast", func() {})
+	s.Run("g", 4)
+	defer shutdown(t, s)
+	c := s.GetClient()
+
+	slow := make([]string, 4)
+	for i := range slow {
+		slow[i], _ = c.Send("g", "slow")
+	}
+
+	// slow达到上限后，其它worker的任务不会被阻塞
+	fast, _ := c.Send("g", "fast")
+	if r, err := c.GetResult(fast, 5*time.Second, 20*time.Millisecond); err != nil || r.Status != message.ResultStatus.Success {
+		t.Fatalf("fast task: GetResult() = %d, %v", r.Status, err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if n := atomic.LoadInt32(&running); n != 2 {
+		t.Errorf("%d slow tasks are running, want 2", n)
+	}
+
+	close(release)
+	for _, id := range slow {
+		if r, err := c.GetResult(id, 10*time.Second, 20*time.Millisecond); err != nil || r.Status != message.ResultStatus.Success {
+			t.Fatalf("slow task %s: GetResult() = %d, %v", id, r.Status, err)
+		}
+	}
+}
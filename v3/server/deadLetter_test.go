@@ -0,0 +1,60 @@
+package server
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eopenio/itask/v3/config"
+	"github.com/eopenio/itask/v3/message"
+)
+
+func TestReplayDeadLetter(t *testing.T) {
+	s := newMemoryServer(config.EnableDeadLetter(true))
+	var runs int32
+	s.Add("g", "w", func(ctl *TaskCtl) {
+		if atomic.AddInt32(&runs, 1) == 1 {
+			ctl.Retry(errors.New("first run fails"))
+		}
+	})
+	s.Run("g", 1)
+	defer shutdown(t, s)
+	c := s.GetClient()
+
+	id, err := c.SetTaskCtl(c.RetryCount, 0).Send("g", "w")
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if r, _ := c.GetResult(id, 5*time.Second, 20*time.Millisecond); r.Status != message.ResultStatus.Failure {
+		t.Fatalf("status of the failed task = %d, want %d", r.Status, message.ResultStatus.Failure)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for n, _ := c.CountDeadLetters("g"); n != 1; n, _ = c.CountDeadLetters("g") {
+		if time.Now().After(deadline) {
+			t.Fatalf("CountDeadLetters() = %d, want 1", n)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	msg, err := c.PeekDeadLetter("g", id)
+	if err != nil || msg.Id != id {
+		t.Fatalf("PeekDeadLetter() = %s, %v, want %s", msg.Id, err, id)
+	}
+
+	if err = c.ReplayDeadLetter("g", id); err != nil {
+		t.Fatalf("ReplayDeadLetter() error = %v", err)
+	}
+	for {
+		r, _ := c.GetResult(id, time.Second, 20*time.Millisecond)
+		if r.Status == message.ResultStatus.Success {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("replayed task has status %d", r.Status)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if n, _ := c.CountDeadLetters("g"); n != 0 {
+		t.Errorf("CountDeadLetters() after replay = %d, want 0", n)
+	}
+}
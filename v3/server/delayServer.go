@@ -12,7 +12,9 @@ import (
 type DelayServer struct {
 	sync.Map
 	ServerUtils
+	groupName      string
 	delayGroupName string
+	priorityLevels int
 
 	// 延时任务的本地队列，用于在本地排序
 	queue SortQueue
@@ -27,6 +29,7 @@ type DelayServer struct {
 	getDelayMsgStopChan  chan struct{}
 	getReadyMsgStopChan  chan struct{}
 	sendReadyMsgStopChan chan struct{}
+	moveDueMsgStopChan   chan struct{}
 }
 
 func NewDelayServer(groupName string, c config.Config, msgChan chan message.Message) DelayServer {
@@ -39,7 +42,11 @@ func NewDelayServer(groupName string, c config.Config, msgChan chan message.Mess
 		getDelayMsgStopChan:  make(chan struct{}),
 		getReadyMsgStopChan:  make(chan struct{}),
 		sendReadyMsgStopChan: make(chan struct{}),
+		moveDueMsgStopChan:   make(chan struct{}),
+		groupName:            groupName,
+		priorityLevels:       c.GetPriorityLevels(),
 	}
+	ds.SetPriorityLevels(ds.priorityLevels)
 	ds.delayGroupName = ds.GetDelayGroupName(groupName)
 	return ds
 }
@@ -77,6 +84,12 @@ func (s *DelayServer) Run() {
 	//log.TaskLog.WithField("server", s.delayGroupName).Infof("Start delayServer[%s] ", s.delayGroupName)
 	s.logger.InfoWithField(fmt.Sprintf("Start delayServer[%s] ", s.delayGroupName), "server", s.delayGroupName)
 
+	// broker自己保存延时消息时，只需要定时把到时间的消息放入队列
+	if s.IsDelayBroker() {
+		go s.MoveDueMsgGoroutine()
+		return
+	}
+
 	go s.GetDelayMsgGoroutine()
 	go s.GetReadyMsgGoroutine()
 	go s.SendReadyMsgGoroutine()
@@ -88,6 +101,10 @@ func (s *DelayServer) safeStop() {
 	s.logger.InfoWithField("waiting for incomplete goroutine ", "server", s.delayGroupName)
 
 	s.SetStop()
+	if s.IsDelayBroker() {
+		<-s.moveDueMsgStopChan
+		return
+	}
 	close(s.readyMsgChan)
 
 	<-s.getDelayMsgStopChan
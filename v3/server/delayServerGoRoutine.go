@@ -2,6 +2,7 @@ package server
 
 import (
 	"fmt"
+	"github.com/eopenio/itask/v3/brokers"
 	"github.com/eopenio/itask/v3/ierrors"
 	"github.com/eopenio/itask/v3/message"
 	"time"
@@ -33,6 +34,11 @@ func (s *DelayServer) GetDelayMsgGoroutine() {
 		//log.TaskLog.WithField("server", s.delayGroupName).WithField("goroutine", "get_delay_message").Debug("get delay msg, ", msg)
 		s.logger.DebugWithField(fmt.Sprint("goroutine get_delay_message get delay msg, ", msg), "server", s.delayGroupName)
 
+		// 延时消息由本地队列保管，停止服务时会LSendQueue放回，所以这里直接确认
+		if err = s.Ack(s.delayGroupName, msg); err != nil {
+			s.logger.ErrorWithField(fmt.Sprint("goroutine get_delay_message ack msg error, ", err), "server", s.delayGroupName)
+		}
+
 		s.GetDelayMsgGoroutine_UpdateQueue(msg)
 
 	}
@@ -49,7 +55,7 @@ func (s *DelayServer) GetDelayMsgGoroutine_UpdateQueue(msg message.Message) {
 		//log.TaskLog.WithField("server", s.delayGroupName).WithField("goroutine", "get_delay_message").Debug("pop msg, ", *popMsg)
 		s.logger.DebugWithField(fmt.Sprint("goroutine get_delay_message pop msg, ", *popMsg), "server", s.delayGroupName)
 
-		err := s.SendMsg(s.delayGroupName, *popMsg)
+		err := s.sendMsg(s.delayGroupName, *popMsg, false)
 		if err != nil {
 			//log.TaskLog.WithField("server", s.delayGroupName).WithField("goroutine", "get_delay_message").Error("Send msg error: ", err, " [msg=", *popMsg, "]")
 			s.logger.ErrorWithField(fmt.Sprint("goroutine get_delay_message Send msg error: ", err, " [msg=", *popMsg, "]"), "server", s.delayGroupName)
@@ -150,3 +156,69 @@ func (s *DelayServer) SendReadyMsgGoroutine_Send(msg message.Message) (err error
 	return
 
 }
+
+// 滚动升级时旧的client还会发送到延时队列，定期迁移
+const migrateQueueInterval = 5 * time.Second
+
+// MoveDueMsgGoroutine
+// describe: used with brokers.DelayBrokerInterface, move due messages to the queues of each priority
+func (s *DelayServer) MoveDueMsgGoroutine() {
+	s.logger.InfoWithField("goroutine move_due_message start", "server", s.delayGroupName)
+
+	var lastMigrate time.Time
+	for !s.IsStop() {
+		if time.Since(lastMigrate) >= migrateQueueInterval {
+			s.MoveDueMsgGoroutine_MigrateQueue()
+			lastMigrate = time.Now()
+		}
+		moved := 0
+		for p := 0; p < s.priorityLevels; p++ {
+			n, err := s.MoveDue(s.groupName, p, 100)
+			if err != nil {
+				s.logger.ErrorWithField(fmt.Sprint("goroutine move_due_message error, ", err), "server", s.delayGroupName)
+				continue
+			}
+			moved += n
+		}
+		if moved > 0 {
+			s.logger.DebugWithField(fmt.Sprintf("goroutine move_due_message moved %d msg", moved), "server", s.delayGroupName)
+			continue
+		}
+		time.Sleep(300 * time.Millisecond)
+	}
+
+	s.moveDueMsgStopChan <- struct{}{}
+	s.logger.InfoWithField("goroutine move_due_message stop", "server", s.delayGroupName)
+}
+
+// MoveDueMsgGoroutine_MigrateQueue
+// describe: messages sent to the delay queue before the broker kept delayed messages itself are scheduled again,
+// runs periodically because old clients keep sending to the delay queue during a rolling upgrade
+func (s *DelayServer) MoveDueMsgGoroutine_MigrateQueue() {
+	ib, canLen := s.broker.(brokers.InspectBrokerInterface)
+	for !s.IsStop() {
+		// 队列为空时Next会阻塞，先检查长度，不耽误移动到期的消息
+		if canLen {
+			if n, err := ib.Len(s.GetQueueName(s.delayGroupName)); err == nil && n == 0 {
+				return
+			}
+		}
+		msg, err := s.Next(s.delayGroupName)
+		if err != nil {
+			if !ierrors.IsEqual(err, ierrors.ErrTypeEmptyQueue) {
+				s.logger.ErrorWithField(fmt.Sprint("goroutine move_due_message get msg error, ", err), "server", s.delayGroupName)
+			}
+			return
+		}
+		err = s.sendMsg(s.delayGroupName, msg, false)
+		if err != nil {
+			s.logger.ErrorWithField(fmt.Sprint("goroutine move_due_message schedule msg error: ", err, " [msg=", msg, "]"), "server", s.delayGroupName)
+			if err = s.LSendMsg(s.delayGroupName, msg); err != nil {
+				s.logger.ErrorWithField(fmt.Sprint("goroutine move_due_message LSend msg error: ", err, " [msg=", msg, "]"), "server", s.delayGroupName)
+			}
+		}
+		if err = s.Ack(s.delayGroupName, msg); err != nil {
+			s.logger.ErrorWithField(fmt.Sprint("goroutine move_due_message ack msg error, ", err), "server", s.delayGroupName)
+		}
+	}
+}
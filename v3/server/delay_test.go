@@ -0,0 +1,45 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/eopenio/itask/v3/config"
+	"github.com/eopenio/itask/v3/message"
+)
+
+func TestDelayBroker(t *testing.T) {
+	s := newMemoryServer(config.EnableDelayServer(true))
+	s.Add("g", "w", func(n int) int { return n })
+	s.Run("g", 1)
+	defer shutdown(t, s)
+	c := s.GetClient()
+
+	start := time.Now()
+	id, err := c.SetTaskCtl(c.RunAfter, 500*time.Millisecond).Send("g", "w", 1)
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if _, err = c.GetResult(id, 5*time.Second, 20*time.Millisecond); err != nil {
+		t.Fatalf("delayed task is not run: %v", err)
+	}
+	if d := time.Since(start); d < 500*time.Millisecond {
+		t.Errorf("delayed task runs after %s, want 500ms", d)
+	}
+
+	// 旧版本的client把延时消息放到延时队列，server运行后发送的也要迁移
+	msg := message.NewMessage(message.NewMsgArgs())
+	msg.WorkerName = "w"
+	msg.SetArgs(2)
+	msg.MsgArgs.RunTime = time.Now()
+	if err = s.config.Broker.Send(c.sUtils.GetQueueName(c.sUtils.GetDelayGroupName("g")), msg); err != nil {
+		t.Fatalf("Send() to the delay queue error = %v", err)
+	}
+	r, err := c.GetResult(msg.Id, 2*migrateQueueInterval, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("message in the delay queue is not migrated: %v", err)
+	}
+	if r.Status != message.ResultStatus.Success {
+		t.Errorf("migrated task has status %d", r.Status)
+	}
+}
@@ -3,11 +3,13 @@ package server
 import (
 	"context"
 	"fmt"
+	"github.com/eopenio/itask/v3/backends"
 	"github.com/eopenio/itask/v3/config"
 	"github.com/eopenio/itask/v3/message"
 	"github.com/eopenio/itask/v3/util"
 	"reflect"
 	"sync"
+	"time"
 )
 
 type InlineServer struct {
@@ -16,11 +18,36 @@ type InlineServer struct {
 
 	groupName                   string
 	workerMap                   map[string]WorkerInterface // [workerName]worker
+	workerOptions               map[string]workerOptions   // [workerName]options
 	workerReadyChan             chan struct{}
 	msgChan                     chan message.Message
 	getMessageGoroutineStopChan chan struct{}
 	workerGoroutineStopChan     chan struct{}
+	requeueGoroutineStopChan    chan struct{}
+	abortGoroutineStopChan      chan struct{}
 	safeStopChan                chan struct{}
+
+	// 运行中任务的context的parent，Shutdown超时后取消
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	running            *sync.Map // [taskId]*taskRun
+	abortCheckInterval time.Duration
+
+	visibilityTimeout time.Duration
+	enableDeadLetter  bool
+	deadLetterStatus  []int
+
+	priorityLevels int
+	priorityAging  int
+	prioritySkip   []int // 每个优先级队列被跳过的次数，用于防止低优先级任务饿死
+
+	prefetch int
+
+	verifyMode int
+
+	// Server.Run没有运行group的延时服务，延时队列中的消息没有人取出
+	noDelayServer bool
 }
 
 func NewInlineServer(groupName string, c config.Config) InlineServer {
@@ -30,13 +57,36 @@ func NewInlineServer(groupName string, c config.Config) InlineServer {
 		c.Logger.SetLevel("debug")
 	}
 
+	su := newServerUtils(c.Broker, c.Backend, c.Logger, c.StatusExpires, c.ResultExpires)
+	su.SetKeyProvider(c.KeyProvider)
+	su.SetSignKeyProvider(c.SignKeyProvider)
+	su.SetCodec(c.Codec)
+	su.SetBlobStore(c.BlobStore, c.BlobThreshold)
+	su.SetPriorityLevels(c.GetPriorityLevels())
+	ctx, cancel := context.WithCancel(context.Background())
+
 	return InlineServer{
 		groupName:                   groupName,
 		workerMap:                   wm,
-		ServerUtils:                 newServerUtils(c.Broker, c.Backend, c.Logger, c.StatusExpires, c.ResultExpires),
+		workerOptions:               make(map[string]workerOptions),
+		ServerUtils:                 su,
 		safeStopChan:                make(chan struct{}),
 		getMessageGoroutineStopChan: make(chan struct{}),
 		workerGoroutineStopChan:     make(chan struct{}),
+		requeueGoroutineStopChan:    make(chan struct{}),
+		abortGoroutineStopChan:      make(chan struct{}),
+		visibilityTimeout:           time.Duration(c.VisibilityTimeout) * time.Second,
+		enableDeadLetter:            c.EnableDeadLetter,
+		deadLetterStatus:            c.DeadLetterStatus,
+		priorityLevels:              c.GetPriorityLevels(),
+		priorityAging:               c.PriorityAging,
+		prioritySkip:                make([]int, c.GetPriorityLevels()),
+		prefetch:                    util.Max(1, c.GetPrefetch(groupName)),
+		verifyMode:                  c.GetVerifyMode(groupName),
+		ctx:                         ctx,
+		cancel:                      cancel,
+		running:                     &sync.Map{},
+		abortCheckInterval:          time.Duration(c.AbortCheckInterval) * time.Second,
 	}
 }
 
@@ -79,6 +129,9 @@ func (t *InlineServer) Run(numWorkers int) {
 		t.SetBrokerPoolSize(t.GetBrokerPoolSize())
 	}
 	t.BrokerActivate()
+	if t.IsAckBroker() && t.visibilityTimeout > 0 {
+		t.SetVisibilityTimeout(t.visibilityTimeout)
+	}
 
 	if t.backend != nil {
 		if t.GetBackendPoolSize() <= 0 {
@@ -87,6 +140,24 @@ func (t *InlineServer) Run(numWorkers int) {
 		t.BackendActivate()
 	}
 
+	for name, opts := range t.workerOptions {
+		if opts.rateLimit != nil {
+			if _, ok := t.backend.(backends.RateLimitBackendInterface); !ok {
+				panic("worker " + name + " has RateLimit, but the backend doesn't support it")
+			}
+		}
+		if opts.concurrency != nil && opts.concurrency.Global {
+			if _, ok := t.backend.(backends.LockBackendInterface); !ok {
+				panic("worker " + name + " has global Concurrency, but the backend doesn't support it")
+			}
+		}
+		if t.noDelayServer {
+			if option := opts.delayedOption(); option != "" {
+				panic("worker " + name + " has " + option + ", but the delay server of group " + t.groupName + " is not running")
+			}
+		}
+	}
+
 	t.logger.InfoWithField(fmt.Sprintf("Start server[%s] numWorkers=%d", t.groupName, numWorkers), "server", t.groupName)
 	t.logger.InfoWithField("group workers:", "server", t.groupName)
 
@@ -104,6 +175,16 @@ func (t *InlineServer) Run(numWorkers int) {
 	t.workerGoroutineStopChan = make(chan struct{}, 1)
 	go t.WorkerGoroutine()
 
+	if t.IsAckBroker() {
+		t.requeueGoroutineStopChan = make(chan struct{})
+		go t.RequeueGoroutine()
+	}
+
+	if t.backend != nil {
+		t.abortGoroutineStopChan = make(chan struct{})
+		go t.AbortGoroutine()
+	}
+
 	for i := 0; i < numWorkers; i++ {
 		t.MakeWorkerReady()
 	}
@@ -120,6 +201,14 @@ func (t *InlineServer) safeStop() {
 	// stop worker goroutine
 	close(t.msgChan)
 	<-t.workerGoroutineStopChan
+
+	if t.IsAckBroker() {
+		t.requeueGoroutineStopChan <- struct{}{}
+	}
+
+	if t.backend != nil {
+		t.abortGoroutineStopChan <- struct{}{}
+	}
 }
 
 func (t *InlineServer) Shutdown(ctx context.Context) error {
@@ -132,6 +221,12 @@ func (t *InlineServer) Shutdown(ctx context.Context) error {
 	select {
 	case <-t.safeStopChan:
 	case <-ctx.Done():
+		// 取消还在运行的任务，给它们一点时间放回队列
+		t.cancel()
+		select {
+		case <-t.safeStopChan:
+		case <-time.After(time.Second):
+		}
 		return ctx.Err()
 	}
 
@@ -141,9 +236,12 @@ func (t *InlineServer) Shutdown(ctx context.Context) error {
 
 // Add worker to group
 // w : worker func
-// callbackFunc : callbackFunc func
+// callbackFunc : callbackFunc func, WorkerOption can be added after it
 func (t *InlineServer) Add(workerName string, w interface{}, callbackFunc ...interface{}) {
 
+	callbackFunc, opts := splitWorkerOptions(callbackFunc)
+	t.workerOptions[workerName] = opts
+
 	var cFunc interface{} = nil
 
 	cType := "func"
@@ -1,10 +1,21 @@
 package server
 
 import (
+	"errors"
 	"fmt"
+	"github.com/eopenio/itask/v3/backends"
+	"github.com/eopenio/itask/v3/config"
 	"github.com/eopenio/itask/v3/ierrors"
 	"github.com/eopenio/itask/v3/message"
+	"github.com/eopenio/itask/v3/util"
+	"github.com/eopenio/itask/v3/util/codec"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -14,27 +25,94 @@ func (t *InlineServer) GetNextMessageGoroutine() {
 	t.logger.DebugWithField("goroutine get_next_message start", "server", t.groupName)
 	var msg message.Message
 	var err error
+	// 预取的消息，只在这个协程中使用
+	var buffer []message.Message
+	// 停止续期预取的消息的租约，与buffer一一对应
+	var stopKeep []func()
 
 	for range t.workerReadyChan {
 		if t.IsStop() {
 			break
 		}
-		msg, err = t.Next(t.groupName)
-		if err != nil {
-			go t.MakeWorkerReady()
-			if !ierrors.IsEqual(err, ierrors.ErrTypeEmptyQueue) {
-				t.logger.ErrorWithField(fmt.Sprint("goroutine get_next_message get msg error, ", err), "server", t.groupName)
+		if len(buffer) == 0 {
+			buffer, err = t.NextPriorityN(t.groupName, t.priorityOrder(), t.prefetch)
+			if err != nil {
+				go t.MakeWorkerReady()
+				if !ierrors.IsEqual(err, ierrors.ErrTypeEmptyQueue) {
+					t.logger.ErrorWithField(fmt.Sprint("goroutine get_next_message get msg error, ", err), "server", t.groupName)
+				}
+				continue
+			}
+			// 等待的预取消息也要续期，否则会在 VisibilityTimeout 后被重新投递
+			stopKeep = make([]func(), len(buffer))
+			for i := range buffer {
+				stopKeep[i] = t.workerGoroutine_KeepLease(buffer[i])
 			}
-			continue
 		}
+		stopKeep[0]()
+		msg, buffer, stopKeep = buffer[0], buffer[1:], stopKeep[1:]
+		t.updatePrioritySkip(msg.MsgArgs.Priority)
 		t.logger.InfoWithField(fmt.Sprintf("goroutine get_next_message new msg %+v", msg), "server", t.groupName)
 		t.msgChan <- msg
 	}
 
+	for _, stop := range stopKeep {
+		stop()
+	}
+	t.getNextMessageGoroutine_ReturnPrefetched(buffer)
 	t.getMessageGoroutineStopChan <- struct{}{}
 	t.logger.DebugWithField("goroutine get_next_message stop", "server", t.groupName)
 }
 
+// getNextMessageGoroutine_ReturnPrefetched
+// describe: put the prefetched messages that have not started back to the head of their queues, keeping the order
+func (t *InlineServer) getNextMessageGoroutine_ReturnPrefetched(buffer []message.Message) {
+	for i := len(buffer) - 1; i >= 0; i-- {
+		var err error
+		if t.IsAckBroker() {
+			err = t.Nack(t.groupName, buffer[i])
+		} else {
+			err = t.LSendMsg(t.groupName, buffer[i])
+		}
+		if err != nil {
+			t.logger.ErrorWithField(fmt.Sprintf("goroutine get_next_message return prefetched msg [id=%s] error: %s", buffer[i].Id, err), "server", t.groupName)
+		}
+	}
+}
+
+// priorityOrder
+// describe: priorities to check in order, from the highest to the lowest,
+// the lowest priority that has been passed over priorityAging times is moved to the front
+func (t *InlineServer) priorityOrder() []int {
+	order := make([]int, 0, t.priorityLevels)
+	aged := -1
+	if t.priorityAging > 0 {
+		for p := 0; p < t.priorityLevels; p++ {
+			if t.prioritySkip[p] >= t.priorityAging {
+				aged = p
+				order = append(order, p)
+				break
+			}
+		}
+	}
+	for p := t.priorityLevels - 1; p >= 0; p-- {
+		if p != aged {
+			order = append(order, p)
+		}
+	}
+	return order
+}
+
+// updatePrioritySkip
+// describe: a message of priority is got, all lower priorities are passed over once
+func (t *InlineServer) updatePrioritySkip(priority int) {
+	priority = util.Min(util.Max(priority, 0), t.priorityLevels-1)
+	for p := 0; p < priority; p++ {
+		t.prioritySkip[p]++
+	}
+	t.prioritySkip[priority] = 0
+}
+
 // WorkerGoroutine
 // describe: start worker to run
 func (t *InlineServer) WorkerGoroutine() {
@@ -51,17 +129,31 @@ func (t *InlineServer) WorkerGoroutine() {
 
 			defer func() { go t.MakeWorkerReady() }()
 
+			run, trusted := t.workerGoroutine_Verify(msg)
+			if !run {
+				t.workerGoroutine_Ack(msg, nil)
+				return
+			}
+
 			w, ok := t.workerMap[msg.WorkerName]
 			if !ok {
 				t.logger.ErrorWithField(fmt.Sprintf("goroutine worker not found worker [%s]", msg.WorkerName), "server", t.groupName)
+				t.workerGoroutine_Ack(msg, nil)
 				return
 			}
 
 			waitWorkerWG.Add(1)
 			defer waitWorkerWG.Done()
 
+			// worker panic 时也要释放租约，让消息重新投递
+			var saveErr = errors.New("worker exited before saving result")
+			defer func() { t.workerGoroutine_Ack(msg, saveErr) }()
+
+			stopTouch := t.workerGoroutine_KeepLease(msg)
+			defer stopTouch()
+
 			result := message.NewResult(msg.Id)
-			t.workerGoroutine_RunWorker(w, &msg, &result)
+			saveErr = t.workerGoroutine_RunWorker(w, &msg, &result, trusted)
 
 		}(msg)
 	}
@@ -71,6 +163,166 @@ func (t *InlineServer) WorkerGoroutine() {
 	t.logger.DebugWithField("goroutine worker stop", "server", t.groupName)
 }
 
+// workerGoroutine_Verify
+// describe: verify the signature of the message
+// return: run: whether the message should run, trusted: whether the server may sign the messages derived from it
+// (retries, rescheduled tasks, next workflow tasks), false if the verification failed in permissive mode
+func (t *InlineServer) workerGoroutine_Verify(msg message.Message) (run bool, trusted bool) {
+	if t.verifyMode == config.SignatureVerifyMode.None {
+		return true, true
+	}
+	err := t.VerifyMsg(msg)
+	if err == nil {
+		return true, true
+	}
+	switch t.verifyMode {
+	case config.SignatureVerifyMode.Permissive:
+		t.logger.WarnWithField(fmt.Sprintf("goroutine worker verify msg [id=%s, worker=%s] %s, run it in permissive mode", msg.Id, msg.WorkerName, err), "server", t.groupName)
+		return true, false
+	case config.SignatureVerifyMode.Quarantine:
+		t.logger.ErrorWithField(fmt.Sprintf("goroutine worker verify msg [id=%s, worker=%s] %s, quarantine it", msg.Id, msg.WorkerName, err), "server", t.groupName)
+		info := message.DeadLetterInfo{
+			GroupName: t.groupName,
+			Err:       err.Error(),
+			Time:      time.Now(),
+		}
+		if e := t.SendQuarantine(t.groupName, msg, info); e != nil {
+			t.logger.ErrorWithField(fmt.Sprintf("goroutine worker quarantine msg [id=%s] error: %s", msg.Id, e), "server", t.groupName)
+		}
+	default:
+		t.logger.ErrorWithField(fmt.Sprintf("goroutine worker verify msg [id=%s, worker=%s] %s, reject it", msg.Id, msg.WorkerName, err), "server", t.groupName)
+	}
+	return false, false
+}
+
+// workerGoroutine_Ack
+// describe: ack the message if the result is saved, otherwise nack it to deliver again
+func (t *InlineServer) workerGoroutine_Ack(msg message.Message, saveErr error) {
+	if !t.IsAckBroker() {
+		return
+	}
+	var err error
+	if saveErr == nil {
+		err = t.Ack(t.groupName, msg)
+	} else {
+		t.logger.WarnWithField(fmt.Sprintf("goroutine worker nack msg [id=%s]: %s", msg.Id, saveErr), "server", t.groupName)
+		err = t.Nack(t.groupName, msg)
+	}
+	if err != nil {
+		t.logger.ErrorWithField(fmt.Sprintf("goroutine worker ack msg [id=%s] error: %s", msg.Id, err), "server", t.groupName)
+	}
+}
+
+// workerGoroutine_KeepLease
+// describe: extend the lease of the running message until the returned func is called
+func (t *InlineServer) workerGoroutine_KeepLease(msg message.Message) func() {
+	vt := t.GetVisibilityTimeout()
+	if !t.IsAckBroker() || vt <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(vt / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := t.Touch(t.groupName, msg); err != nil {
+					t.logger.ErrorWithField(fmt.Sprintf("goroutine worker touch msg [id=%s] error: %s", msg.Id, err), "server", t.groupName)
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// RequeueGoroutine
+// describe: put the messages whose lease has expired back to the queue
+func (t *InlineServer) RequeueGoroutine() {
+	t.logger.DebugWithField("goroutine requeue start", "server", t.groupName)
+
+	interval := t.GetVisibilityTimeout() / 4
+	if interval < time.Second {
+		interval = time.Second
+	} else if interval > time.Minute {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.requeueGoroutineStopChan:
+			t.logger.DebugWithField("goroutine requeue stop", "server", t.groupName)
+			return
+		case <-ticker.C:
+			for p := 0; p < t.priorityLevels; p++ {
+				n, err := t.Requeue(t.groupName, p)
+				if err != nil {
+					t.logger.ErrorWithField(fmt.Sprint("goroutine requeue error, ", err), "server", t.groupName)
+				} else if n > 0 {
+					t.logger.InfoWithField(fmt.Sprintf("goroutine requeue %d expired msg [priority=%d]", n, p), "server", t.groupName)
+				}
+			}
+		}
+	}
+}
+
+// AbortGoroutine
+// describe: cancel the context of running tasks that are aborted,
+// by the signals pushed by the backend (backends.AbortBackendInterface) and by periodic checks
+func (t *InlineServer) AbortGoroutine() {
+	t.logger.DebugWithField("goroutine abort start", "server", t.groupName)
+
+	if ab, ok := t.backend.(backends.AbortBackendInterface); ok {
+		unsubscribe, err := ab.SubscribeAbort(t.abortGoroutine_Cancel)
+		if err != nil {
+			t.logger.ErrorWithField(fmt.Sprint("goroutine abort subscribe error, ", err), "server", t.groupName)
+		} else {
+			defer unsubscribe()
+		}
+	}
+
+	var tick <-chan time.Time
+	if t.abortCheckInterval > 0 {
+		ticker := time.NewTicker(t.abortCheckInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-t.abortGoroutineStopChan:
+			t.logger.DebugWithField("goroutine abort stop", "server", t.groupName)
+			return
+		case <-tick:
+			t.running.Range(func(key, _ interface{}) bool {
+				id := key.(string)
+				isAbort, reason, err := t.GetAbort(id)
+				if err != nil {
+					t.logger.ErrorWithField(fmt.Sprintf("goroutine abort check task [id=%s] error: %s", id, err), "server", t.groupName)
+				} else if isAbort {
+					t.abortGoroutine_Cancel(id, reason)
+				}
+				return true
+			})
+		}
+	}
+}
+
+// abortGoroutine_Cancel
+// describe: cancel the context of the task if it is running in this server
+func (t *InlineServer) abortGoroutine_Cancel(id string, reason string) {
+	v, ok := t.running.Load(id)
+	if !ok {
+		return
+	}
+	t.logger.InfoWithField(fmt.Sprintf("goroutine abort running task [id=%s]: %s", id, reason), "server", t.groupName)
+	v.(*taskRun).cancelWith(ierrors.ErrAbortTask{Msg: reason})
+}
+
 // workerGoroutine_UpdateWorkflowResult
 // return : current Workflow index
 func (t *InlineServer) workerGoroutine_UpdateWorkflowResult(ctl TaskCtl, result *message.Result) int {
@@ -89,25 +341,80 @@ func (t *InlineServer) workerGoroutine_UpdateWorkflowResult(ctl TaskCtl, result
 }
 
 // workerGoroutine_RunWorker
-func (t *InlineServer) workerGoroutine_RunWorker(w WorkerInterface, msg *message.Message, result *message.Result) {
+// return: error of saving the final result
+func (t *InlineServer) workerGoroutine_RunWorker(w WorkerInterface, msg *message.Message, result *message.Result, trusted bool) (saveErr error) {
 	var err error
+	var attempts int
+	var wait time.Duration
+	var release, releaseSlot func()
 	ctl := NewTaskCtl(*msg)
 	ctl.SetServerUtil(&t.ServerUtils)
+	stopCtx := ctl.startContext(t.ctx)
+	defer stopCtx()
+	t.running.Store(msg.Id, ctl.run)
+	defer t.running.Delete(msg.Id)
+	// Shutdown超时后取到的消息不再运行
+	if t.ctx.Err() != nil {
+		return t.workerGoroutine_Return(*msg)
+	}
 	workflowIndex := -1
 	if len(ctl.MsgArgs.Workflow) > 0 {
 		workflowIndex = t.workerGoroutine_UpdateWorkflowResult(ctl, result)
 	}
+	// 重新投递的重试任务，接着之前的运行次数
+	attempts = msg.MsgArgs.Attempts
+	if attempts > 0 {
+		result.Status = message.ResultStatus.WaitingRetry
+		result.RetryCount = attempts - 1
+	}
+
+	// 已满的worker的任务放入延时队列，不占用worker协程，也不阻塞其它worker的消息
+	releaseSlot, wait = t.workerGoroutine_Concurrency(ctl)
+	// Run因为取消提前返回时，函数返回后才释放
+	defer ctl.whenIdle(releaseSlot)()
+	if wait > 0 {
+		t.logger.DebugWithField(fmt.Sprintf("goroutine worker concurrency limit of worker[%s], delay task [id=%s] %s", msg.WorkerName, msg.Id, wait), "server", t.groupName)
+		return t.workerGoroutine_Reschedule(*msg, wait, trusted)
+	}
+
+	funcArgs, err := t.DecryptArgs(*msg)
+	if err != nil {
+		t.logger.ErrorWithField(fmt.Sprintf("goroutine worker load args error %s [id=%s]", err, msg.Id), "server", t.groupName)
+		result.Err = err.Error()
+		t.workerGoroutine_UpdateResultStatus(message.ResultStatus.Failure, workflowIndex, result)
+		saveErr = t.workerGoroutine_SaveResult(*result)
+		goto AFTER
+	}
+
+	if wait = t.workerGoroutine_RateLimit(ctl); wait > 0 {
+		t.logger.DebugWithField(fmt.Sprintf("goroutine worker rate limit of worker[%s], delay task [id=%s] %s", msg.WorkerName, msg.Id, wait), "server", t.groupName)
+		return t.workerGoroutine_Reschedule(*msg, wait, trusted)
+	}
+
+	release, err = t.workerGoroutine_Lock(ctl, funcArgs)
+	defer ctl.whenIdle(release)()
+	if err != nil {
+		if opts := t.lockOptions(ctl); ierrors.IsEqual(err, ierrors.ErrTypeLockBusy) && opts.OnBusy == LockBusyPolicy.Reschedule {
+			t.logger.InfoWithField(fmt.Sprintf("goroutine worker %s, reschedule task [id=%s] after %s", err, msg.Id, opts.RetryAfter), "server", t.groupName)
+			return t.workerGoroutine_Reschedule(*msg, opts.RetryAfter, trusted)
+		}
+		t.logger.ErrorWithField(fmt.Sprintf("goroutine worker lock error %s [id=%s]", err, msg.Id), "server", t.groupName)
+		result.Err = err.Error()
+		t.workerGoroutine_UpdateResultStatus(message.ResultStatus.Failure, workflowIndex, result)
+		saveErr = t.workerGoroutine_SaveResult(*result)
+		goto AFTER
+	}
 
-RUN:
-	if f, _ := ctl.IsAbort(); f {
+	if f, reason, _ := t.GetAbort(ctl.Id); f {
+		result.Err = ierrors.ErrAbortTask{Msg: reason}.Error()
 		t.workerGoroutine_UpdateResultStatus(message.ResultStatus.Abort, workflowIndex, result)
-		t.workerGoroutine_SaveResult(*result)
+		saveErr = t.workerGoroutine_SaveResult(*result)
 		goto AFTER
 	}
 
 	if ctl.IsExpired() {
 		t.workerGoroutine_UpdateResultStatus(message.ResultStatus.Expired, workflowIndex, result)
-		t.workerGoroutine_SaveResult(*result)
+		saveErr = t.workerGoroutine_SaveResult(*result)
 		goto AFTER
 	}
 
@@ -115,46 +422,326 @@ RUN:
 	t.workerGoroutine_UpdateResultStatus(result.Status, workflowIndex, result)
 	t.workerGoroutine_SaveResult(*result)
 
-	err = w.Run(&ctl, msg.FuncArgs, result)
+	attempts++
+	ctl.startTimeout(t.workerGoroutine_Timeout(ctl))
+	err = w.Run(&ctl, funcArgs, result)
 
 	if err == nil {
 		t.workerGoroutine_UpdateResultStatus(message.ResultStatus.Success, workflowIndex, result)
-		t.workerGoroutine_SaveResult(*result)
+		saveErr = t.workerGoroutine_SaveResult(*result)
 		goto AFTER
 	}
 	t.logger.ErrorWithField(fmt.Sprintf("goroutine worker run worker[%s] error %s", msg.WorkerName, err), "server", t.groupName)
 
-	if ctl.CanRetry() {
-		result.Status = message.ResultStatus.WaitingRetry
-		ctl.MsgArgs.RetryCount -= 1
-		//msg.Ctl = ctl
-		//log.TaskLog.WithField("server", t.groupName).WithField("goroutine", "worker").Infof("retry task %s", msg)
-		t.logger.InfoWithField(fmt.Sprintf("goroutine worker retry task %s", msg), "server", t.groupName)
-		ctl.SetError(nil)
+	if ierrors.IsEqual(err, ierrors.ErrTypeServerStop) {
+		return t.workerGoroutine_Return(*msg)
+	}
 
-		goto RUN
-	} else {
-		result.Err = err.Error()
-		status := message.ResultStatus.Failure
-		if ierrors.IsEqual(err, ierrors.ErrTypeAbortTask) {
-			status = message.ResultStatus.Abort
+	result.Err = err.Error()
+	if ctl.CanRetry() && t.workerGoroutine_IsRetryable(ctl, err) {
+		if e := t.workerGoroutine_Retry(*msg, ctl, attempts, err, trusted); e == nil {
+			result.Status = message.ResultStatus.WaitingRetry
+			saveErr = t.workerGoroutine_SaveResult(*result)
+			return
 		}
-		t.workerGoroutine_UpdateResultStatus(status, workflowIndex, result)
-		t.workerGoroutine_SaveResult(*result)
 	}
+	switch {
+	case ierrors.IsEqual(err, ierrors.ErrTypeAbortTask):
+		t.workerGoroutine_UpdateResultStatus(message.ResultStatus.Abort, workflowIndex, result)
+	case ierrors.IsEqual(err, ierrors.ErrTypeTaskTimeout):
+		t.workerGoroutine_UpdateResultStatus(message.ResultStatus.Timeout, workflowIndex, result)
+	default:
+		t.workerGoroutine_UpdateResultStatus(message.ResultStatus.Failure, workflowIndex, result)
+	}
+	saveErr = t.workerGoroutine_SaveResult(*result)
 
 AFTER:
+	t.workerGoroutine_DeadLetter(*msg, *result, attempts)
+
 	// 为了逻辑更简单，工作流和回调暂不兼容
 	if workflowIndex >= 0 {
 		if !result.IsFailure() && workflowIndex+1 < len(ctl.MsgArgs.Workflow) {
-			t.workerGoroutine_NextWorkflow(workflowIndex+1, ctl, *result)
+			t.workerGoroutine_NextWorkflow(workflowIndex+1, ctl, *result, trusted)
 		}
 	} else {
-		err = w.After(&ctl, msg.FuncArgs, result)
+		err = w.After(&ctl, funcArgs, result)
 		if err != nil {
 			t.logger.ErrorWithField(fmt.Sprintf("goroutine worker run worker[%s] callback error %s", msg.WorkerName, err), "server", t.groupName)
 		}
 	}
+	return
+}
+
+// lockOptions nil: 任务不需要锁
+func (t *InlineServer) lockOptions(ctl TaskCtl) *LockOptions {
+	opts := t.workerOptions[ctl.WorkerName]
+	if opts.lock == nil && len(ctl.MsgArgs.Locks) > 0 {
+		LockOptions{}.apply(&opts)
+	}
+	return opts.lock
+}
+
+// lockName 把 {i} 替换为第i个参数解码后的值，与参数的codec无关
+func lockName(name string, funcArgs []string) string {
+	for i, arg := range funcArgs {
+		p := "{" + strconv.Itoa(i) + "}"
+		if !strings.Contains(name, p) {
+			continue
+		}
+		var v interface{}
+		if codec.Decode(arg, &v) == nil {
+			arg = fmt.Sprint(v)
+		}
+		name = strings.ReplaceAll(name, p, arg)
+	}
+	return name
+}
+
+// workerGoroutine_Lock
+// describe: acquire all locks of the task and renew them until release is called,
+// return ierrors.ErrLockBusy if one of them is held by another task, release is never nil
+func (t *InlineServer) workerGoroutine_Lock(ctl TaskCtl, funcArgs []string) (release func(), err error) {
+	noop := func() {}
+	opts := t.lockOptions(ctl)
+	if opts == nil {
+		return noop, nil
+	}
+	if t.backend == nil {
+		return noop, ierrors.ErrNilBackend{}
+	}
+	lb, ok := t.backend.(backends.LockBackendInterface)
+	if !ok {
+		return noop, ierrors.ErrUnsupportedOp{Op: "Lock"}
+	}
+
+	var names []string
+	for _, name := range append(append([]string(nil), opts.Names...), ctl.MsgArgs.Locks...) {
+		names = append(names, lockName(name, funcArgs))
+	}
+	if len(names) == 0 {
+		names = []string{ctl.WorkerName}
+	}
+	// 按顺序获取，减少多个任务互相持有对方需要的锁
+	sort.Strings(names)
+
+	ttl := util.Max(1, int(math.Ceil(opts.TTL.Seconds())))
+	var keys []string
+	unlock := func() {
+		for _, key := range keys {
+			if e := lb.DelUnique(key, ctl.Id); e != nil {
+				t.logger.ErrorWithField(fmt.Sprintf("goroutine worker release lock [%s] error: %s", key, e), "server", t.groupName)
+			}
+		}
+	}
+	for i, name := range names {
+		if i > 0 && name == names[i-1] {
+			continue
+		}
+		key := t.GetLockKey(name)
+		// 同一个任务重新投递时，仍然持有的锁可以直接使用
+		owner, ok, err := lb.SetUnique(key, ctl.Id, ttl)
+		if err != nil || (!ok && owner != ctl.Id) {
+			unlock()
+			if err == nil {
+				err = ierrors.ErrLockBusy{Name: name}
+			}
+			return noop, err
+		}
+		keys = append(keys, key)
+	}
+
+	stop := t.workerGoroutine_KeepKeys(lb, keys, ctl.Id, opts.TTL)
+	return func() {
+		stop()
+		unlock()
+	}, nil
+}
+
+// workerGoroutine_KeepKeys
+// describe: renew the keys set by SetUnique every ttl/3 until the returned func is called
+func (t *InlineServer) workerGoroutine_KeepKeys(lb backends.LockBackendInterface, keys []string, owner string, ttl time.Duration) func() {
+	exTime := util.Max(1, int(math.Ceil(ttl.Seconds())))
+	interval := ttl / 3
+	if interval < 100*time.Millisecond {
+		interval = 100 * time.Millisecond
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				for _, key := range keys {
+					ok, err := lb.ExpireUnique(key, owner, exTime)
+					if err != nil || !ok {
+						t.logger.WarnWithField(fmt.Sprintf("goroutine worker renew [%s] of task [id=%s] failed: ok=%v, err=%v", key, owner, ok, err), "server", t.groupName)
+					}
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// workerGoroutine_Concurrency
+// describe: take a running slot of the worker, return how long the task should be delayed if the worker is saturated
+func (t *InlineServer) workerGoroutine_Concurrency(ctl TaskCtl) (release func(), wait time.Duration) {
+	noop := func() {}
+	c := t.workerOptions[ctl.WorkerName].concurrency
+	if c == nil {
+		return noop, 0
+	}
+	if atomic.AddInt32(c.running, 1) > int32(c.Max) {
+		atomic.AddInt32(c.running, -1)
+		return noop, c.RetryAfter
+	}
+	releaseLocal := func() { atomic.AddInt32(c.running, -1) }
+	if !c.Global {
+		return releaseLocal, 0
+	}
+
+	// Run 中已检查过backend，从随机位置开始找空闲的slot，减少冲突
+	lb := t.backend.(backends.LockBackendInterface)
+	ttl := util.Max(1, int(math.Ceil(c.TTL.Seconds())))
+	start := rand.Intn(c.Max)
+	for i := 0; i < c.Max; i++ {
+		key := t.GetConcurrencyKey(t.groupName, ctl.WorkerName, (start+i)%c.Max)
+		owner, ok, err := lb.SetUnique(key, ctl.Id, ttl)
+		if err != nil {
+			// backend出错时不能确定是否超过限制，稍后再试
+			t.logger.ErrorWithField(fmt.Sprintf("goroutine worker take slot of worker[%s] error: %s", ctl.WorkerName, err), "server", t.groupName)
+			break
+		}
+		if ok || owner == ctl.Id {
+			stop := t.workerGoroutine_KeepKeys(lb, []string{key}, ctl.Id, c.TTL)
+			return func() {
+				stop()
+				if e := lb.DelUnique(key, ctl.Id); e != nil {
+					t.logger.ErrorWithField(fmt.Sprintf("goroutine worker release slot [%s] error: %s", key, e), "server", t.groupName)
+				}
+				releaseLocal()
+			}, 0
+		}
+	}
+	releaseLocal()
+	return noop, c.RetryAfter
+}
+
+// workerGoroutine_Timeout
+// describe: timeout of the task, the one set by the client first
+func (t *InlineServer) workerGoroutine_Timeout(ctl TaskCtl) time.Duration {
+	if ctl.MsgArgs.Timeout > 0 {
+		return ctl.MsgArgs.Timeout
+	}
+	return t.workerOptions[ctl.WorkerName].timeout
+}
+
+// workerGoroutine_Return
+// describe: the task is interrupted by shutdown, put it back to run it again after the server restarts
+func (t *InlineServer) workerGoroutine_Return(msg message.Message) error {
+	t.logger.WarnWithField(fmt.Sprintf("goroutine worker task [id=%s] is interrupted by shutdown, put it back", msg.Id), "server", t.groupName)
+	// AckBroker 通过nack放回
+	if t.IsAckBroker() {
+		return ierrors.ErrServerStop{}
+	}
+	err := t.LSendMsg(t.groupName, msg)
+	if err != nil {
+		t.logger.ErrorWithField(fmt.Sprintf("goroutine worker put back task [id=%s] error: %s", msg.Id, err), "server", t.groupName)
+	}
+	return err
+}
+
+// workerGoroutine_IsRetryable
+// describe: whether the task failed with err should retry
+func (t *InlineServer) workerGoroutine_IsRetryable(ctl TaskCtl, err error) bool {
+	if ierrors.IsPermanent(err) || ierrors.IsEqual(err, ierrors.ErrTypeAbortTask) {
+		return false
+	}
+	if _, ok := ierrors.GetRetryAfter(err); ok {
+		return true
+	}
+	if f := t.workerOptions[ctl.WorkerName].retryable; f != nil {
+		return f(err)
+	}
+	return true
+}
+
+// workerGoroutine_Retry
+// describe: send the failed task back to run again, after the delay of ierrors.RetryAfter or the backoff of the task or the worker
+func (t *InlineServer) workerGoroutine_Retry(msg message.Message, ctl TaskCtl, attempts int, err error, trusted bool) error {
+	msg.MsgArgs.RetryCount = ctl.MsgArgs.RetryCount - 1
+	msg.MsgArgs.Attempts = attempts
+
+	backoff := ctl.MsgArgs.Backoff
+	if backoff == nil {
+		backoff = t.workerOptions[ctl.WorkerName].backoff
+	}
+	delay, ok := ierrors.GetRetryAfter(err)
+	if !ok && backoff != nil {
+		delay = backoff.Next(attempts)
+	}
+	t.logger.InfoWithField(fmt.Sprintf("goroutine worker retry task [id=%s] after %s, remaining retries %d", msg.Id, delay, msg.MsgArgs.RetryCount), "server", t.groupName)
+	if delay > 0 {
+		return t.workerGoroutine_Reschedule(msg, delay, trusted)
+	}
+	t.workerGoroutine_RenewArgs(msg)
+	err = t.sendMsg(t.groupName, msg, trusted)
+	if err != nil {
+		t.logger.ErrorWithField(fmt.Sprintf("goroutine worker retry task [id=%s] error: %s", msg.Id, err), "server", t.groupName)
+	}
+	return err
+}
+
+// workerGoroutine_RateLimit
+// describe: take a token of the worker, return how long the task should be delayed if there is none
+func (t *InlineServer) workerGoroutine_RateLimit(ctl TaskCtl) time.Duration {
+	rl := t.workerOptions[ctl.WorkerName].rateLimit
+	if rl == nil {
+		return 0
+	}
+	// Run 中已检查过backend
+	wait, err := t.backend.(backends.RateLimitBackendInterface).TakeToken(t.GetRateLimitKey(t.groupName, ctl.WorkerName), rl.Rate, rl.Burst)
+	if err != nil {
+		// backend出错时不能确定是否超过限制，稍后再试
+		t.logger.ErrorWithField(fmt.Sprintf("goroutine worker take token of worker[%s] error: %s", ctl.WorkerName, err), "server", t.groupName)
+		return time.Second
+	}
+	return wait
+}
+
+// workerGoroutine_Reschedule
+// describe: send the message to the delay queue of the group to run it after d,
+// or back to the queue of the group at once if the delay server is not running
+func (t *InlineServer) workerGoroutine_Reschedule(msg message.Message, d time.Duration, trusted bool) error {
+	groupName := t.groupName
+	if t.noDelayServer {
+		t.logger.WarnWithField(fmt.Sprintf("goroutine worker delay server is not running, resend task [id=%s] without delay %s", msg.Id, d), "server", t.groupName)
+	} else {
+		groupName = t.GetDelayGroupName(t.groupName)
+		msg.MsgArgs.RunTime = time.Now().Add(d)
+	}
+	t.workerGoroutine_RenewArgs(msg)
+	err := t.sendMsg(groupName, msg, trusted)
+	if err != nil {
+		t.logger.ErrorWithField(fmt.Sprintf("goroutine worker reschedule task [id=%s] error: %s", msg.Id, err), "server", t.groupName)
+	}
+	return err
+}
+
+// workerGoroutine_RenewArgs
+// describe: keep the blob of the args until the re-sent task runs, the task fails when it runs if this fails
+func (t *InlineServer) workerGoroutine_RenewArgs(msg message.Message) {
+	if err := t.RenewArgs(msg); err != nil {
+		t.logger.ErrorWithField(fmt.Sprintf("goroutine worker renew args of task [id=%s] error: %s", msg.Id, err), "server", t.groupName)
+	}
 }
 
 // workerGoroutine_UpdateResultStatus
@@ -170,7 +757,7 @@ func (t *InlineServer) workerGoroutine_UpdateResultStatus(status int, workflowIn
 }
 
 // workerGoroutine_SaveResult
-func (t *InlineServer) workerGoroutine_SaveResult(result message.Result) {
+func (t *InlineServer) workerGoroutine_SaveResult(result message.Result) error {
 	//log.TaskLog.WithField("server", t.groupName).WithField("goroutine", "worker").Debugf("save result %+v", result)
 	t.logger.DebugWithField(fmt.Sprintf("goroutine worker save result %+v", result), "server", t.groupName)
 
@@ -179,16 +766,51 @@ func (t *InlineServer) workerGoroutine_SaveResult(result message.Result) {
 		//log.TaskLog.WithField("server", t.groupName).WithField("goroutine", "worker").Errorf("save result error: ", err)
 		t.logger.ErrorWithField(fmt.Sprint("goroutine worker save result error: ", err), "server", t.groupName)
 	}
+	return err
+}
+
+// workerGoroutine_DeadLetter
+// describe: copy the message to the dead letter queue if the final status is one of deadLetterStatus
+func (t *InlineServer) workerGoroutine_DeadLetter(msg message.Message, result message.Result, attempts int) {
+	if !t.enableDeadLetter {
+		return
+	}
+	isDead := false
+	for _, status := range t.deadLetterStatus {
+		if result.Status == status {
+			isDead = true
+			break
+		}
+	}
+	if !isDead {
+		return
+	}
+	// 重放时按发送时的重试次数重新运行
+	msg.MsgArgs.RetryCount += msg.MsgArgs.Attempts
+	msg.MsgArgs.Attempts = 0
+	info := message.DeadLetterInfo{
+		GroupName: t.groupName,
+		Status:    result.Status,
+		Err:       result.Err,
+		Attempts:  attempts,
+		Time:      time.Now(),
+	}
+	err := t.SendDeadLetter(t.groupName, msg, info)
+	if err != nil {
+		t.logger.ErrorWithField(fmt.Sprintf("goroutine worker send dead letter error %s [id=%s]", err, msg.Id), "server", t.groupName)
+	}
 }
 
 // workerGoroutine_NextWorkflow
-func (t *InlineServer) workerGoroutine_NextWorkflow(nextIndex int, ctl TaskCtl, result message.Result) {
+func (t *InlineServer) workerGoroutine_NextWorkflow(nextIndex int, ctl TaskCtl, result message.Result, trusted bool) {
 
 	next := ctl.MsgArgs.Workflow[nextIndex]
 	t.logger.DebugWithField(fmt.Sprintf("goroutine worker send next workflow [id=%s, next=%s]", ctl.Id, next.WorkerName), "server", t.groupName)
 
 	ctl.FuncArgs = result.FuncReturn
 	ctl.SetRetryCount(next.RetryCount)
+	ctl.MsgArgs.Attempts = 0
+	ctl.MsgArgs.Priority = util.Min(util.Max(next.Priority, 0), t.priorityLevels-1)
 	if next.RunAfter != 0 {
 		n := time.Now()
 		ctl.SetRunTime(n.Add(next.RunAfter))
@@ -197,11 +819,19 @@ func (t *InlineServer) workerGoroutine_NextWorkflow(nextIndex int, ctl TaskCtl,
 		ctl.SetExpireTime(next.ExpireTime)
 	}
 	groupName := next.GroupName
+	// 只知道本group是否运行了延时服务，其它group的延时消息照常发送
+	if !ctl.IsZeroRunTime() && t.noDelayServer && groupName == t.groupName {
+		t.logger.WarnWithField(fmt.Sprintf("goroutine worker delay server is not running, send next workflow [id=%s] without delay", ctl.Id), "server", t.groupName)
+		ctl.SetRunTime(time.Time{})
+	}
 	if !ctl.IsZeroRunTime() {
 		groupName = t.GetDelayGroupName(groupName)
 	}
 	ctl.WorkerName = next.WorkerName
-	err := t.SendMsg(groupName, ctl.Message)
+	err := t.EncryptArgs(&ctl.Message)
+	if err == nil {
+		err = t.sendMsg(groupName, ctl.Message, trusted)
+	}
 
 	if err != nil {
 		t.logger.ErrorWithField(fmt.Sprintf("send next workflow error %s [id=%s]", err, ctl.Id), "server", t.groupName)
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eopenio/itask/v3/config"
+	"github.com/eopenio/itask/v3/message"
+)
+
+// 没有设置锁名时使用worker名，worker不会同时运行
+func TestLockSingleton(t *testing.T) {
+	s := newMemoryServer(config.EnableDelayServer(true))
+	var running, maxRunning int32
+	s.Add("g", "w", func() {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}, LockOptions{RetryAfter: 100 * time.Millisecond})
+	s.Run("g", 3)
+	defer shutdown(t, s)
+	c := s.GetClient()
+
+	ids := make([]string, 4)
+	for i := range ids {
+		ids[i], _ = c.Send("g", "w")
+	}
+	for _, id := range ids {
+		if r, err := c.GetResult(id, 10*time.Second, 20*time.Millisecond); err != nil || r.Status != message.ResultStatus.Success {
+			t.Fatalf("task %s: GetResult() = %d, %v", id, r.Status, err)
+		}
+	}
+	if m := atomic.LoadInt32(&maxRunning); m != 1 {
+		t.Errorf("at most %d tasks run at the same time, want 1", m)
+	}
+}
+
+func TestLockBusyFail(t *testing.T) {
+	s := newMemoryServer()
+	s.Add("g", "w", func(account string) {
+		time.Sleep(300 * time.Millisecond)
+	}, LockOptions{Names: []string{"account:{0}"}, OnBusy: LockBusyPolicy.Fail})
+	s.Run("g", 2)
+	defer shutdown(t, s)
+	client := s.GetClient()
+	c := client.SetTaskCtl(ctlKey.RetryCount, 0)
+
+	first, _ := c.Send("g", "w", "a")
+	time.Sleep(50 * time.Millisecond)
+	busy, _ := c.Send("g", "w", "a")
+	for id, want := range map[string]int{first: message.ResultStatus.Success, busy: message.ResultStatus.Failure} {
+		r, err := c.GetResult(id, 5*time.Second, 20*time.Millisecond)
+		if err != nil || r.Status != want {
+			t.Errorf("task %s: GetResult() = %d, %v, want status %d", id, r.Status, err, want)
+		}
+	}
+}
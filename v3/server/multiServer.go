@@ -28,7 +28,7 @@ func NewServer(c config.Config) Server {
 
 // Add worker to group
 // w : worker func
-// callbackFunc:callbackFunc
+// callbackFunc:callbackFunc, WorkerOption can be added after it
 func (t *Server) Add(groupName string, workerName string, w interface{}, callbackFunc ...interface{}) {
 	server := t.getOrCreateInlineServer(groupName)
 	server.Add(workerName, w, callbackFunc...)
@@ -65,9 +65,12 @@ func (t *Server) Run(groupName string, numWorkers int, enableDelayServer ...bool
 	if !ok {
 		panic("Task: not found group: " + groupName)
 	}
+	// broker保存延时消息时不需要本地队列
+	runDelayServer := (t.config.EnableDelayServer && (t.config.DelayServerQueueSize > 0 || server.IsDelayBroker())) ||
+		(len(enableDelayServer) > 0 && enableDelayServer[0])
+	server.noDelayServer = !runDelayServer
 	server.Run(numWorkers)
-	if (t.config.EnableDelayServer && t.config.DelayServerQueueSize > 0) ||
-		(len(enableDelayServer) > 0 && enableDelayServer[0]) {
+	if runDelayServer {
 		ds := t.getOrCreateDelayServer(groupName)
 		ds.Run()
 	}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eopenio/itask/v3/brokers"
+	"github.com/eopenio/itask/v3/config"
+	"github.com/eopenio/itask/v3/message"
+)
+
+func TestNextPriorityN(t *testing.T) {
+	br := brokers.NewMemoryBroker()
+	su := newServerUtils(&br, nil, nil, 0, 0)
+	su.SetPriorityLevels(2)
+	for i, priority := range []int{0, 0, 1, 0} {
+		msg := message.NewMessage(message.NewMsgArgs())
+		msg.MsgArgs.Priority = priority
+		msg.WorkerName = string(rune('a' + i))
+		if err := br.Send(su.GetPriorityQueueName("g", priority), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 每次只从一个队列批量读取，高优先级队列先读
+	var got []string
+	for _, want := range []int{1, 2} {
+		msgs, err := su.NextPriorityN("g", []int{1, 0}, 2)
+		if err != nil || len(msgs) != want {
+			t.Fatalf("NextPriorityN() = %d messages, %v, want %d", len(msgs), err, want)
+		}
+		for _, msg := range msgs {
+			got = append(got, msg.WorkerName)
+		}
+	}
+	if strings.Join(got, "") != "cab" {
+		t.Errorf("NextPriorityN() returns %v, want [c a b]", got)
+	}
+}
+
+func TestPrefetchRunsAllTasks(t *testing.T) {
+	s := newMemoryServer(config.Prefetch(5))
+	var runs int32
+	s.Add("g", "w", func() { atomic.AddInt32(&runs, 1) })
+	s.Run("g", 2)
+	defer shutdown(t, s)
+	c := s.GetClient()
+
+	ids := make([]string, 20)
+	for i := range ids {
+		ids[i], _ = c.Send("g", "w")
+	}
+	for _, id := range ids {
+		if r, err := c.GetResult(id, 5*time.Second, 20*time.Millisecond); err != nil || r.Status != message.ResultStatus.Success {
+			t.Fatalf("task %s: GetResult() = %d, %v", id, r.Status, err)
+		}
+	}
+	if n := atomic.LoadInt32(&runs); n != 20 {
+		t.Errorf("%d runs, want 20", n)
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/eopenio/itask/v3/config"
+	"github.com/eopenio/itask/v3/message"
+	"github.com/eopenio/itask/v3/util"
+)
+
+// client不知道server的优先级数量，发送的任何优先级都要被server执行
+func TestClientPriorityAboveServerLevels(t *testing.T) {
+	for _, levels := range []int{1, 3} {
+		s := newMemoryServer(config.Priority(levels, 0))
+		s.Add("g", "add", func(a, b int) int { return a + b })
+		s.Run("g", 2)
+
+		sc := s.config.Clone()
+		config.Priority(config.MaxPriorityLevels, 0)(&sc)
+		c := NewClient(sc)
+		for _, priority := range []int{0, levels, config.MaxPriorityLevels - 1, 100} {
+			id, err := c.SetTaskCtl(c.Priority, priority).Send("g", "add", priority, 1)
+			if err != nil {
+				t.Fatalf("levels %d: Send() with priority %d: %v", levels, priority, err)
+			}
+			r, err := c.GetResult(id, 10*time.Second, 20*time.Millisecond)
+			if err != nil {
+				t.Fatalf("levels %d: task with priority %d is not run: %v", levels, priority, err)
+			}
+			if r.Status != message.ResultStatus.Success {
+				t.Errorf("levels %d: task with priority %d has status %d", levels, priority, r.Status)
+			}
+		}
+		shutdown(t, s)
+	}
+}
+
+// 消息发送到的队列要被server读取，并且server确认消息时使用同一个队列
+func TestPriorityQueueNames(t *testing.T) {
+	var client ServerUtils
+	for levels := 1; levels <= config.MaxPriorityLevels; levels++ {
+		var server ServerUtils
+		server.SetPriorityLevels(levels)
+		for priority := 0; priority < config.MaxPriorityLevels+2; priority++ {
+			name := client.GetPriorityQueueName("g", priority)
+			if ackName := server.GetPriorityQueueName("g", priority); ackName != name {
+				t.Errorf("levels %d: priority %d is sent to %s, but acked on %s", levels, priority, name, ackName)
+			}
+			read := server.GetPriorityQueueNames("g", util.Min(priority, levels-1))
+			found := false
+			for _, n := range read {
+				found = found || n == name
+			}
+			if !found {
+				t.Errorf("levels %d: priority %d is sent to %s, but the server reads %v", levels, priority, name, read)
+			}
+		}
+	}
+}
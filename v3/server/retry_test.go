@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eopenio/itask/v3/backends"
+	"github.com/eopenio/itask/v3/brokers"
+	"github.com/eopenio/itask/v3/config"
+	"github.com/eopenio/itask/v3/ierrors"
+	"github.com/eopenio/itask/v3/message"
+)
+
+func newMemoryServer(setConfigFunc ...config.SetConfigFunc) Server {
+	br := brokers.NewMemoryBroker()
+	be := backends.NewMemoryBackend()
+	return NewServer(config.NewConfig(append([]config.SetConfigFunc{config.Broker(&br), config.Backend(&be)}, setConfigFunc...)...))
+}
+
+func shutdown(t *testing.T, s Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown(): %v", err)
+	}
+}
+
+func TestRunWithoutDelayServer(t *testing.T) {
+	s := newMemoryServer()
+	s.Add("g", "w", func() {}, RetryBackoff{Delay: time.Second})
+	defer func() {
+		if recover() == nil {
+			t.Error("Run() of a worker with RetryBackoff but no delay server doesn't panic")
+		}
+	}()
+	s.Run("g", 1)
+}
+
+// 没有延时服务时，重试的任务立即重新投递
+func TestRetryAfterWithoutDelayServer(t *testing.T) {
+	s := newMemoryServer()
+	var runs int32
+	s.Add("g", "w", func(ctl *TaskCtl) {
+		if atomic.AddInt32(&runs, 1) == 1 {
+			ctl.Retry(ierrors.RetryAfter(errors.New("busy"), time.Hour))
+		}
+	})
+	s.Run("g", 1)
+	defer shutdown(t, s)
+
+	c := s.GetClient()
+	id, err := c.SetTaskCtl(c.RetryCount, 1).Send("g", "w")
+	if err != nil {
+		t.Fatalf("Send(): %v", err)
+	}
+	r, err := c.GetResult(id, 10*time.Second, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("GetResult(): %v", err)
+	}
+	if r.Status != message.ResultStatus.Success || atomic.LoadInt32(&runs) != 2 {
+		t.Errorf("status %d after %d runs, want %d after 2 runs", r.Status, runs, message.ResultStatus.Success)
+	}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eopenio/itask/v3/ierrors"
+	"github.com/eopenio/itask/v3/message"
+)
+
+var errInvalid = errors.New("invalid")
+
+func TestRetryable(t *testing.T) {
+	s := newMemoryServer()
+	runs := map[string]*int32{"permanent": new(int32), "wrapped": new(int32), "retryable": new(int32), "plain": new(int32)}
+	fail := func(name string, err error) func(ctl *TaskCtl) {
+		return func(ctl *TaskCtl) {
+			atomic.AddInt32(runs[name], 1)
+			ctl.Retry(err)
+		}
+	}
+	s.Add("g", "permanent", fail("permanent", ierrors.Permanent(errInvalid)))
+	s.Add("g", "wrapped", fail("wrapped", fmt.Errorf("charge: %w", ierrors.Permanent(errInvalid))))
+	s.Add("g", "retryable", fail("retryable", errInvalid), Retryable(func(err error) bool {
+		return !errors.Is(err, errInvalid)
+	}))
+	s.Add("g", "plain", fail("plain", errInvalid))
+	s.Run("g", 1)
+	defer shutdown(t, s)
+	client := s.GetClient()
+	c := client.SetTaskCtl(client.RetryCount, 2)
+
+	for _, tt := range []struct {
+		worker string
+		runs   int32
+	}{
+		{"permanent", 1},
+		{"wrapped", 1},
+		{"retryable", 1},
+		{"plain", 3},
+	} {
+		id, err := c.Send("g", tt.worker)
+		if err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+		r, err := c.GetResult(id, 5*time.Second, 20*time.Millisecond)
+		if err != nil {
+			t.Fatalf("%s: GetResult() error = %v", tt.worker, err)
+		}
+		if r.Status != message.ResultStatus.Failure || !strings.Contains(r.Err, errInvalid.Error()) {
+			t.Errorf("%s: status %d with error %q, want %d with %q", tt.worker, r.Status, r.Err, message.ResultStatus.Failure, errInvalid)
+		}
+		if n := atomic.LoadInt32(runs[tt.worker]); n != tt.runs {
+			t.Errorf("%s: %d runs, want %d", tt.worker, n, tt.runs)
+		}
+	}
+}
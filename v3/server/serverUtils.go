@@ -1,14 +1,27 @@
 package server
 
 import (
+	"fmt"
 	"github.com/eopenio/itask/v3/backends"
+	"github.com/eopenio/itask/v3/blob"
 	"github.com/eopenio/itask/v3/brokers"
+	"github.com/eopenio/itask/v3/config"
 	"github.com/eopenio/itask/v3/ierrors"
 	"github.com/eopenio/itask/v3/log"
 	"github.com/eopenio/itask/v3/message"
+	"github.com/eopenio/itask/v3/util"
+	"github.com/eopenio/itask/v3/util/codec"
+	"github.com/eopenio/itask/v3/util/envelope"
+	"github.com/eopenio/itask/v3/util/sign"
+	"math"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// sendBatchSize SendMsgBatch 每次请求最多发送的消息数
+const sendBatchSize = 1000
+
 // ServerUtils 用于把 delayServer，inlineServer，client 用到的方法抽离出来
 type ServerUtils struct {
 	broker  brokers.BrokerInterface
@@ -18,20 +31,221 @@ type ServerUtils struct {
 	// config
 	statusExpires int // second, -1:forever
 	resultExpires int // second, -1:forever
+
+	encryptor *envelope.Encryptor // nil: 不加密
+	signer    *sign.Signer        // nil: 不签名
+	codec     codec.Codec         // nil: JSON
+
+	blobStore     blob.StoreInterface // nil: 不转存
+	blobThreshold int
+
+	priorityLevels int // 0: client，只发送消息
 }
 
 func newServerUtils(broker brokers.BrokerInterface, backend backends.BackendInterface, logger log.LoggerInterface, statusExpires int, resultExpires int) ServerUtils {
 	return ServerUtils{broker: broker, backend: backend, logger: logger, statusExpires: statusExpires, resultExpires: resultExpires}
 }
 
+// SetCodec 设置编码任务参数的codec，nil表示JSON
+func (b *ServerUtils) SetCodec(c codec.Codec) {
+	b.codec = c
+}
+
+// SetPriorityLevels server按自己的优先级数量读取队列，最高优先级同时读取更高优先级的队列
+func (b *ServerUtils) SetPriorityLevels(levels int) {
+	b.priorityLevels = levels
+}
+
+// newMessage 消息带上codec名称，JSON不设置，与旧版本的消息保持一致
+func (b *ServerUtils) newMessage(workerName string, msgArgs message.MessageArgs) message.Message {
+	var msg = message.NewMessage(msgArgs)
+	msg.WorkerName = workerName
+	if b.codec != nil && b.codec.Name() != codec.JSONName {
+		msg.Codec = b.codec.Name()
+	}
+	return msg
+}
+
+// SetBlobStore 超过threshold字节的参数和结果保存到store中，nil表示不转存
+func (b *ServerUtils) SetBlobStore(store blob.StoreInterface, threshold int) {
+	b.blobStore = store
+	b.blobThreshold = threshold
+}
+
+// blobExpires blob与结果同时过期，不保存结果时使用状态的过期时间
+func (b *ServerUtils) blobExpires() int {
+	if b.resultExpires != 0 {
+		return b.resultExpires
+	}
+	return b.statusExpires
+}
+
+// argsBlobExpires 参数的blob要保留到任务运行之后，延时的任务加上等待的时间
+func (b *ServerUtils) argsBlobExpires(msg message.Message) int {
+	ex := b.blobExpires()
+	if ex < 0 {
+		return ex
+	}
+	if wait := time.Until(msg.MsgArgs.RunTime); wait > 0 {
+		ex += int(math.Ceil(wait.Seconds()))
+	}
+	return ex
+}
+
+// RenewArgs 重新投递（重试、延后）的任务续期参数的blob
+func (b *ServerUtils) RenewArgs(msg message.Message) error {
+	return blob.Renew(b.blobStore, msg.FuncArgs, b.argsBlobExpires(msg))
+}
+
+// SetKeyProvider 设置后加密任务参数和结果，nil表示不加密
+func (b *ServerUtils) SetKeyProvider(p envelope.KeyProvider) {
+	if p == nil {
+		b.encryptor = nil
+		return
+	}
+	e := envelope.NewEncryptor(p)
+	b.encryptor = &e
+}
+
+// EncryptArgs 加密msg.FuncArgs，已加密的不会重复加密；超过阈值时转存到blob store
+func (b *ServerUtils) EncryptArgs(msg *message.Message) error {
+	if b.encryptor != nil && len(msg.FuncArgs) > 0 && !envelope.IsEncryptedSlice(msg.FuncArgs) && !blob.IsRef(msg.FuncArgs) {
+		r, err := b.encryptor.EncryptSlice(msg.FuncArgs, msg.Id)
+		if err != nil {
+			return err
+		}
+		msg.FuncArgs = r
+	}
+	r, err := blob.Offload(b.blobStore, msg.FuncArgs, b.blobThreshold, b.argsBlobExpires(*msg))
+	if err != nil {
+		return err
+	}
+	msg.FuncArgs = r
+	return nil
+}
+
+// DecryptArgs 返回解密后的msg.FuncArgs，转存的参数在这里才取回，未加密的原样返回
+func (b *ServerUtils) DecryptArgs(msg message.Message) ([]string, error) {
+	values, err := blob.Resolve(b.blobStore, msg.FuncArgs)
+	if err != nil {
+		return nil, err
+	}
+	return b.decrypt(values, msg.Id)
+}
+
+func (b *ServerUtils) decrypt(values []string, id string) ([]string, error) {
+	if !envelope.IsEncryptedSlice(values) {
+		return values, nil
+	}
+	if b.encryptor == nil {
+		return nil, ierrors.ErrDecrypt{Msg: "no key provider"}
+	}
+	r, err := b.encryptor.DecryptSlice(values, id)
+	if err != nil {
+		return nil, ierrors.ErrDecrypt{Msg: err.Error()}
+	}
+	return r, nil
+}
+
+// SetSignKeyProvider 设置后发送的消息都会签名，nil表示不签名
+func (b *ServerUtils) SetSignKeyProvider(p envelope.KeyProvider) {
+	if p == nil {
+		b.signer = nil
+		return
+	}
+	s := sign.NewSigner(p)
+	b.signer = &s
+}
+
+// SignMsg 没有设置key时不签名
+func (b *ServerUtils) SignMsg(msg *message.Message) error {
+	if b.signer == nil {
+		return nil
+	}
+	data, err := msg.SigningBytes()
+	if err != nil {
+		return err
+	}
+	keyId, sig, err := b.signer.Sign(data)
+	if err != nil {
+		return err
+	}
+	msg.Signature = &message.MessageSignature{KeyId: keyId, Sig: sig}
+	return nil
+}
+
+func (b *ServerUtils) VerifyMsg(msg message.Message) error {
+	if b.signer == nil {
+		return ierrors.ErrSignature{Msg: "no sign key provider"}
+	}
+	if msg.Signature == nil {
+		return ierrors.ErrSignature{Msg: "message is not signed"}
+	}
+	data, err := msg.SigningBytes()
+	if err != nil {
+		return ierrors.ErrSignature{Msg: err.Error()}
+	}
+	if err = b.signer.Verify(msg.Signature.KeyId, msg.Signature.Sig, data); err != nil {
+		return ierrors.ErrSignature{Msg: err.Error()}
+	}
+	return nil
+}
+
 func (b ServerUtils) GetQueueName(groupName string) string {
 	return "itask:queue:" + groupName
 }
 
+// GetPriorityQueueName 默认优先级使用原来的队列
+// 消息所在的队列只由优先级决定，与server的优先级数量无关，确认消息时才能找到同一个队列
+func (b ServerUtils) GetPriorityQueueName(groupName string, priority int) string {
+	priority = util.Min(priority, config.MaxPriorityLevels-1)
+	if priority <= 0 {
+		return b.GetQueueName(groupName)
+	}
+	return b.GetQueueName(groupName) + ":p" + strconv.Itoa(priority)
+}
+
+// GetPriorityQueueNames
+// describe: queues read for the priority, the top priority of a server also reads the queues of the priorities
+// above it, which are sent by clients that don't know its PriorityLevels, higher priorities first
+func (b ServerUtils) GetPriorityQueueNames(groupName string, priority int) []string {
+	if priority < b.maxPriority() {
+		return []string{b.GetPriorityQueueName(groupName, priority)}
+	}
+	names := make([]string, 0, config.MaxPriorityLevels-b.maxPriority())
+	for p := config.MaxPriorityLevels - 1; p >= b.maxPriority(); p-- {
+		names = append(names, b.GetPriorityQueueName(groupName, p))
+	}
+	return names
+}
+
+func (b ServerUtils) maxPriority() int {
+	if b.priorityLevels > 0 {
+		return util.Min(b.priorityLevels, config.MaxPriorityLevels) - 1
+	}
+	return config.MaxPriorityLevels - 1
+}
+
 func (b ServerUtils) GetDelayGroupName(groupName string) string {
 	return "delay:" + groupName
 }
 
+func (b ServerUtils) IsDelayGroupName(groupName string) bool {
+	return strings.HasPrefix(groupName, "delay:")
+}
+
+func (b ServerUtils) GetGroupNameFromDelayGroupName(delayGroupName string) string {
+	return strings.TrimPrefix(delayGroupName, "delay:")
+}
+
+// getMsgQueueName 延时队列只有一个，不区分优先级
+func (b ServerUtils) getMsgQueueName(groupName string, msg message.Message) string {
+	if b.IsDelayGroupName(groupName) {
+		return b.GetQueueName(groupName)
+	}
+	return b.GetPriorityQueueName(groupName, msg.MsgArgs.Priority)
+}
+
 func (b *ServerUtils) GetBrokerPoolSize() int {
 	return b.broker.GetPoolSize()
 }
@@ -48,22 +262,149 @@ func (b *ServerUtils) Next(groupName string) (message.Message, error) {
 	return b.broker.Next(b.GetQueueName(groupName))
 }
 
+// NextPriority 按priorities的顺序从各优先级队列获取消息
+func (b *ServerUtils) NextPriority(groupName string, priorities []int) (message.Message, error) {
+	queueNames := b.priorityQueueNames(groupName, priorities)
+	if len(queueNames) == 1 {
+		return b.broker.Next(queueNames[0])
+	}
+	if pb, ok := b.broker.(brokers.PriorityBrokerInterface); ok {
+		return pb.NextFrom(queueNames...)
+	}
+	var msg message.Message
+	var err error
+	for _, name := range queueNames {
+		msg, err = b.broker.Next(name)
+		if err == nil || !ierrors.IsEqual(err, ierrors.ErrTypeEmptyQueue) {
+			return msg, err
+		}
+	}
+	return msg, err
+}
+
+// priorityQueueNames 按priorities的顺序展开各优先级读取的队列
+func (b *ServerUtils) priorityQueueNames(groupName string, priorities []int) []string {
+	var names []string
+	for _, p := range priorities {
+		names = append(names, b.GetPriorityQueueNames(groupName, p)...)
+	}
+	return names
+}
+
+// NextPriorityN
+// describe: take at most n messages from the first non-empty priority queue in one round trip,
+// wait for one message like NextPriority if all queues are empty or the broker can not prefetch
+func (b *ServerUtils) NextPriorityN(groupName string, priorities []int, n int) ([]message.Message, error) {
+	if pb, ok := b.broker.(brokers.PrefetchBrokerInterface); ok && n > 1 {
+		for _, name := range b.priorityQueueNames(groupName, priorities) {
+			msgs, err := pb.NextN(name, n)
+			if err == nil {
+				return msgs, nil
+			}
+			if !ierrors.IsEqual(err, ierrors.ErrTypeEmptyQueue) {
+				return nil, err
+			}
+		}
+	}
+	msg, err := b.NextPriority(groupName, priorities)
+	if err != nil {
+		return nil, err
+	}
+	return []message.Message{msg}, nil
+}
+
 // Send msg to Queue
 // t.Send("groupName", "workerName" , 1,"hi",1.2)
 func (b *ServerUtils) Send(groupName string, workerName string, msgArgs message.MessageArgs, args ...interface{}) (string, error) {
-	var msg = message.NewMessage(msgArgs)
-	msg.WorkerName = workerName
-	err := msg.SetArgs(args...)
+	msg, err := b.buildMessage(workerName, msgArgs, args...)
 	if err != nil {
 		return "", err
 	}
 	return msg.Id, b.SendMsg(groupName, msg)
 }
 
+// buildMessage 编码并加密参数
+func (b *ServerUtils) buildMessage(workerName string, msgArgs message.MessageArgs, args ...interface{}) (message.Message, error) {
+	var msg = b.newMessage(workerName, msgArgs)
+	err := msg.SetArgs(args...)
+	if err != nil {
+		return msg, err
+	}
+	err = b.EncryptArgs(&msg)
+	return msg, err
+}
+
+func (b ServerUtils) GetUniqueKey(key string) string {
+	return "itask:unique:" + key
+}
+
+func (b ServerUtils) GetLockKey(name string) string {
+	return "itask:lock:" + name
+}
+
+func (b ServerUtils) GetRateLimitKey(groupName string, workerName string) string {
+	return "itask:rate:" + groupName + ":" + workerName
+}
+
+func (b ServerUtils) GetConcurrencyKey(groupName string, workerName string, slot int) string {
+	return fmt.Sprintf("itask:concurrency:%s:%s:%d", groupName, workerName, slot)
+}
+
+// SendUnique 在backend中原子地记录key，window内相同key的任务只发送一次，返回第一次发送的taskId
+func (b *ServerUtils) SendUnique(key string, window time.Duration, groupName string, workerName string, msgArgs message.MessageArgs, args ...interface{}) (string, error) {
+	if b.backend == nil {
+		return "", ierrors.ErrNilBackend{}
+	}
+	ub, ok := b.backend.(backends.UniqueBackendInterface)
+	if !ok {
+		return "", ierrors.ErrUnsupportedOp{Op: "SendUnique"}
+	}
+	msg, err := b.buildMessage(workerName, msgArgs, args...)
+	if err != nil {
+		return "", err
+	}
+	uniqueKey := b.GetUniqueKey(key)
+	id, ok, err := ub.SetUnique(uniqueKey, msg.Id, util.Max(1, int(math.Ceil(window.Seconds()))))
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return id, nil
+	}
+	if err = b.SendMsg(groupName, msg); err != nil {
+		// 发送失败时释放key，重试时可以重新发送
+		if e := ub.DelUnique(uniqueKey, msg.Id); e != nil {
+			b.logger.Error(fmt.Sprintf("release unique key [%s] error: %s", key, e))
+		}
+		return "", err
+	}
+	return msg.Id, nil
+}
+
 func (b *ServerUtils) SendMsg(groupName string, msg message.Message) error {
+	return b.sendMsg(groupName, msg, true)
+}
+
+// sendMsg sign: 是否重新签名，server只给自己信任的消息签名，其它消息保留原来的签名
+func (b *ServerUtils) sendMsg(groupName string, msg message.Message, sign bool) error {
+	if sign {
+		if err := b.SignMsg(&msg); err != nil {
+			return err
+		}
+	}
+	send := func() error {
+		return b.broker.Send(b.getMsgQueueName(groupName, msg), msg)
+	}
+	// broker自己保存延时消息，到时间后直接放入对应的队列
+	if db, ok := b.delayBroker(); ok && b.IsDelayGroupName(groupName) {
+		queueName := b.GetPriorityQueueName(b.GetGroupNameFromDelayGroupName(groupName), msg.MsgArgs.Priority)
+		send = func() error {
+			return db.Schedule(queueName, msg, msg.MsgArgs.GetRunTime())
+		}
+	}
 	var err error
 	for i := 0; i < 3; i++ {
-		err = b.broker.Send(b.GetQueueName(groupName), msg)
+		err = send()
 		if err == nil {
 			break
 		}
@@ -72,17 +413,383 @@ func (b *ServerUtils) SendMsg(groupName string, msg message.Message) error {
 	return err
 }
 
+// SendBatch 每个task生成一条消息后批量发送
+// return: taskIds ("" if failed), errs (nil if all tasks are sent)
+func (b *ServerUtils) SendBatch(tasks []BatchTask, msgArgs message.MessageArgs) ([]string, []error) {
+	ids := make([]string, len(tasks))
+	errs := make([]error, len(tasks))
+	groupNames := make([]string, 0, len(tasks))
+	msgs := make([]message.Message, 0, len(tasks))
+	index := make([]int, 0, len(tasks))
+	for i, task := range tasks {
+		var msg = b.newMessage(task.WorkerName, msgArgs)
+		if err := msg.SetArgs(task.Args...); err != nil {
+			errs[i] = err
+			continue
+		}
+		if err := b.EncryptArgs(&msg); err != nil {
+			errs[i] = err
+			continue
+		}
+		groupNames = append(groupNames, task.GroupName)
+		msgs = append(msgs, msg)
+		index = append(index, i)
+	}
+	sendErrs := b.SendMsgBatch(groupNames, msgs)
+	for j, i := range index {
+		if sendErrs != nil && sendErrs[j] != nil {
+			errs[i] = sendErrs[j]
+			continue
+		}
+		ids[i] = msgs[j].Id
+	}
+	for _, err := range errs {
+		if err != nil {
+			return ids, errs
+		}
+	}
+	return ids, nil
+}
+
+// SendMsgBatch 按队列分组，broker支持时每批消息只需一次请求，否则逐个发送
+// 与SendMsg不同，这里不会重试，失败的消息在errs中返回，由调用方决定是否重发
+//   - groupNames: groupNames[i] is the group of msgs[i]
+func (b *ServerUtils) SendMsgBatch(groupNames []string, msgs []message.Message) []error {
+	errs := make([]error, len(msgs))
+	bb, isBatch := b.broker.(brokers.BatchBrokerInterface)
+	db, isDelay := b.delayBroker()
+	// 保持队列的发送顺序
+	var queueNames []string
+	indexes := make(map[string][]int)
+	msgs = append([]message.Message(nil), msgs...)
+	for i, msg := range msgs {
+		if err := b.SignMsg(&msg); err != nil {
+			errs[i] = err
+			continue
+		}
+		msgs[i] = msg
+		groupName := groupNames[i]
+		if isDelay && b.IsDelayGroupName(groupName) {
+			queueName := b.GetPriorityQueueName(b.GetGroupNameFromDelayGroupName(groupName), msg.MsgArgs.Priority)
+			errs[i] = db.Schedule(queueName, msg, msg.MsgArgs.GetRunTime())
+			continue
+		}
+		queueName := b.getMsgQueueName(groupName, msg)
+		if !isBatch {
+			errs[i] = b.broker.Send(queueName, msg)
+			continue
+		}
+		if _, ok := indexes[queueName]; !ok {
+			queueNames = append(queueNames, queueName)
+		}
+		indexes[queueName] = append(indexes[queueName], i)
+	}
+	for _, queueName := range queueNames {
+		index := indexes[queueName]
+		for start := 0; start < len(index); start += sendBatchSize {
+			end := util.Min(start+sendBatchSize, len(index))
+			batch := make([]message.Message, 0, end-start)
+			for _, i := range index[start:end] {
+				batch = append(batch, msgs[i])
+			}
+			batchErrs := bb.SendBatch(queueName, batch)
+			if batchErrs == nil {
+				continue
+			}
+			for j, i := range index[start:end] {
+				errs[i] = batchErrs[j]
+			}
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return errs
+		}
+	}
+	return nil
+}
+
+// LSendMsg 把取出的消息原样放回队首，不重新签名，避免未验证的消息得到有效的签名
 func (b *ServerUtils) LSendMsg(groupName string, msg message.Message) error {
 	var err error
 	for i := 0; i < 3; i++ {
-		err = b.broker.LSend(b.GetQueueName(groupName), msg)
+		err = b.broker.LSend(b.getMsgQueueName(groupName, msg), msg)
+		if err == nil {
+			break
+		}
+	}
+	return err
+}
+
+func (b *ServerUtils) delayBroker() (brokers.DelayBrokerInterface, bool) {
+	db, ok := b.broker.(brokers.DelayBrokerInterface)
+	return db, ok
+}
+
+// IsDelayBroker 是否由broker保存延时消息
+func (b *ServerUtils) IsDelayBroker() bool {
+	_, ok := b.delayBroker()
+	return ok
+}
+
+// MoveDue 把到时间的延时消息放入对应的队列
+func (b *ServerUtils) MoveDue(groupName string, priority int, limit int) (int, error) {
+	db, ok := b.delayBroker()
+	if !ok {
+		return 0, ierrors.ErrUnsupportedOp{Op: "move due messages"}
+	}
+	moved := 0
+	for _, name := range b.GetPriorityQueueNames(groupName, priority) {
+		n, err := db.MoveDue(name, limit)
+		moved += n
+		if err != nil {
+			return moved, err
+		}
+	}
+	return moved, nil
+}
+
+func (b *ServerUtils) ackBroker() (brokers.AckBrokerInterface, bool) {
+	ab, ok := b.broker.(brokers.AckBrokerInterface)
+	return ab, ok
+}
+
+// IsAckBroker 是否支持消息确认
+func (b *ServerUtils) IsAckBroker() bool {
+	_, ok := b.ackBroker()
+	return ok
+}
+
+func (b *ServerUtils) SetVisibilityTimeout(d time.Duration) {
+	if ab, ok := b.ackBroker(); ok {
+		ab.SetVisibilityTimeout(d)
+	}
+}
+
+func (b *ServerUtils) GetVisibilityTimeout() time.Duration {
+	if ab, ok := b.ackBroker(); ok {
+		return ab.GetVisibilityTimeout()
+	}
+	return 0
+}
+
+// Ack 确认消息已处理完成，broker不支持确认时什么都不做
+func (b *ServerUtils) Ack(groupName string, msg message.Message) error {
+	if ab, ok := b.ackBroker(); ok {
+		return ab.Ack(b.getMsgQueueName(groupName, msg), msg)
+	}
+	return nil
+}
+
+// Nack 消息处理失败，放回队列等待重新投递
+func (b *ServerUtils) Nack(groupName string, msg message.Message) error {
+	if ab, ok := b.ackBroker(); ok {
+		return ab.Nack(b.getMsgQueueName(groupName, msg), msg)
+	}
+	return nil
+}
+
+// Touch 延长正在运行的消息的租约
+func (b *ServerUtils) Touch(groupName string, msg message.Message) error {
+	if ab, ok := b.ackBroker(); ok {
+		return ab.Touch(b.getMsgQueueName(groupName, msg), msg)
+	}
+	return nil
+}
+
+// Requeue 把租约过期的消息放回队列
+func (b *ServerUtils) Requeue(groupName string, priority int) (int, error) {
+	ab, ok := b.ackBroker()
+	if !ok {
+		return 0, nil
+	}
+	requeued := 0
+	for _, name := range b.GetPriorityQueueNames(groupName, priority) {
+		n, err := ab.Requeue(name)
+		requeued += n
+		if err != nil {
+			return requeued, err
+		}
+	}
+	return requeued, nil
+}
+
+func (b ServerUtils) GetDeadLetterQueueName(groupName string) string {
+	return "itask:dead:" + groupName
+}
+
+func (b *ServerUtils) inspectBroker() (brokers.InspectBrokerInterface, error) {
+	ib, ok := b.broker.(brokers.InspectBrokerInterface)
+	if !ok {
+		return nil, ierrors.ErrUnsupportedOp{Op: "inspect queue"}
+	}
+	return ib, nil
+}
+
+// SendDeadLetter 把消息复制到死信队列
+func (b *ServerUtils) SendDeadLetter(groupName string, msg message.Message, info message.DeadLetterInfo) error {
+	msg.DeadLetter = &info
+	var err error
+	for i := 0; i < 3; i++ {
+		err = b.broker.Send(b.GetDeadLetterQueueName(groupName), msg)
 		if err == nil {
 			break
 		}
+		time.Sleep(1 * time.Second)
 	}
 	return err
 }
 
+func (b *ServerUtils) CountDeadLetters(groupName string) (int, error) {
+	ib, err := b.inspectBroker()
+	if err != nil {
+		return 0, err
+	}
+	return ib.Len(b.GetDeadLetterQueueName(groupName))
+}
+
+// ListDeadLetters stop=-1 表示到最后一个
+func (b *ServerUtils) ListDeadLetters(groupName string, start int, stop int) ([]message.Message, error) {
+	ib, err := b.inspectBroker()
+	if err != nil {
+		return nil, err
+	}
+	return ib.Range(b.GetDeadLetterQueueName(groupName), start, stop)
+}
+
+func (b *ServerUtils) PeekDeadLetter(groupName string, id string) (message.Message, error) {
+	msgs, err := b.ListDeadLetters(groupName, 0, -1)
+	if err != nil {
+		return message.Message{}, err
+	}
+	for _, msg := range msgs {
+		if msg.Id == id {
+			return msg, nil
+		}
+	}
+	return message.Message{}, ierrors.ErrNotFound{Id: id}
+}
+
+// ReplayDeadLetter 从死信队列中取出消息，重新发送到原来的group
+func (b *ServerUtils) ReplayDeadLetter(groupName string, id string) error {
+	ib, err := b.inspectBroker()
+	if err != nil {
+		return err
+	}
+	msg, err := ib.Remove(b.GetDeadLetterQueueName(groupName), id)
+	if err != nil {
+		return err
+	}
+	err = b.replay(groupName, msg)
+	if err != nil {
+		// 发送失败时放回死信队列，避免丢失
+		if e := ib.LSend(b.GetDeadLetterQueueName(groupName), msg); e != nil {
+			b.logger.Error(fmt.Sprintf("replay dead letter [id=%s] error: %s, put back error: %s", id, err, e))
+		}
+	}
+	return err
+}
+
+// ReplayAllDeadLetters return: 重新发送的消息数
+func (b *ServerUtils) ReplayAllDeadLetters(groupName string) (int, error) {
+	msgs, err := b.ListDeadLetters(groupName, 0, -1)
+	if err != nil {
+		return 0, err
+	}
+	if rb, ok := b.broker.(brokers.RemoveBatchBrokerInterface); ok {
+		return b.replayAllRemoved(rb, groupName, msgs)
+	}
+	n := 0
+	for _, msg := range msgs {
+		err = b.ReplayDeadLetter(groupName, msg.Id)
+		if err != nil {
+			if ierrors.IsEqual(err, ierrors.ErrTypeNotFound) {
+				continue
+			}
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// replayAllRemoved 一次取出所有消息再重新发送，避免每条消息都扫描一遍死信队列
+func (b *ServerUtils) replayAllRemoved(rb brokers.RemoveBatchBrokerInterface, groupName string, msgs []message.Message) (int, error) {
+	queueName := b.GetDeadLetterQueueName(groupName)
+	ids := make([]string, len(msgs))
+	for i, msg := range msgs {
+		ids[i] = msg.Id
+	}
+	removed, err := rb.RemoveBatch(queueName, ids)
+	n := 0
+	if err == nil {
+		for ; n < len(removed); n++ {
+			if err = b.replay(groupName, removed[n]); err != nil {
+				break
+			}
+		}
+	}
+	// 出错时没有重新发送的消息放回死信队列，从后往前放回保持原来的顺序
+	if err != nil {
+		for i := len(removed) - 1; i >= n; i-- {
+			if e := rb.LSend(queueName, removed[i]); e != nil {
+				b.logger.Error(fmt.Sprintf("replay dead letter [id=%s] error: %s, put back error: %s", removed[i].Id, err, e))
+			}
+		}
+	}
+	return n, err
+}
+
+func (b *ServerUtils) PurgeDeadLetters(groupName string) error {
+	ib, err := b.inspectBroker()
+	if err != nil {
+		return err
+	}
+	return ib.Purge(b.GetDeadLetterQueueName(groupName))
+}
+
+func (b ServerUtils) GetQuarantineQueueName(groupName string) string {
+	return "itask:quarantine:" + groupName
+}
+
+// SendQuarantine 签名验证失败的消息放入隔离队列，不会被执行，也不能重放
+func (b *ServerUtils) SendQuarantine(groupName string, msg message.Message, info message.DeadLetterInfo) error {
+	msg.DeadLetter = &info
+	return b.broker.Send(b.GetQuarantineQueueName(groupName), msg)
+}
+
+// ListQuarantined stop=-1 表示到最后一个
+func (b *ServerUtils) ListQuarantined(groupName string, start int, stop int) ([]message.Message, error) {
+	ib, err := b.inspectBroker()
+	if err != nil {
+		return nil, err
+	}
+	return ib.Range(b.GetQuarantineQueueName(groupName), start, stop)
+}
+
+func (b *ServerUtils) PurgeQuarantined(groupName string) error {
+	ib, err := b.inspectBroker()
+	if err != nil {
+		return err
+	}
+	return ib.Purge(b.GetQuarantineQueueName(groupName))
+}
+
+func (b *ServerUtils) replay(groupName string, msg message.Message) error {
+	// 过期的任务重放时不再检查过期时间
+	if msg.DeadLetter != nil && msg.DeadLetter.Status == message.ResultStatus.Expired {
+		msg.MsgArgs.ExpireTime = time.Time{}
+	}
+	msg.DeadLetter = nil
+	// 中止的任务重放时清除中止标记，否则会被再次中止
+	if db, ok := b.backend.(backends.DelResultBackendInterface); ok {
+		if err := db.DelResult(message.NewAbortResult(msg.Id).GetBackendKey()); err != nil {
+			return err
+		}
+	}
+	return b.SendMsg(groupName, msg)
+}
+
 func (b *ServerUtils) GetBackendPoolSize() int {
 	if b.backend == nil {
 		return 0
@@ -117,35 +824,84 @@ func (b *ServerUtils) SetResult(result message.Result) error {
 	if exTime == 0 {
 		return nil
 	}
+	if b.encryptor != nil && len(result.FuncReturn) > 0 && !envelope.IsEncryptedSlice(result.FuncReturn) {
+		r, err := b.encryptor.EncryptSlice(result.FuncReturn, result.Id)
+		if err != nil {
+			return err
+		}
+		result.FuncReturn = r
+	}
+	r, err := blob.Offload(b.blobStore, result.FuncReturn, b.blobThreshold, b.blobExpires())
+	if err != nil {
+		return err
+	}
+	result.FuncReturn = r
 	return b.backend.SetResult(result, exTime)
 }
 
+// GetResult FuncReturn 已取回并解密
 func (b *ServerUtils) GetResult(id string) (message.Result, error) {
+	return b.getResult(id, true)
+}
+
+// getResult resolve: 是否取回转存的结果并解密，只需要状态时不用取回
+func (b *ServerUtils) getResult(id string, resolve bool) (message.Result, error) {
 	if b.backend == nil {
 		return message.Result{}, ierrors.ErrNilResult{}
 	}
 	result := message.NewResult(id)
-	return b.backend.GetResult(result.GetBackendKey())
+	result, err := b.backend.GetResult(result.GetBackendKey())
+	if err != nil || !resolve {
+		return result, err
+	}
+	funcReturn, err := blob.Resolve(b.blobStore, result.FuncReturn)
+	if err != nil {
+		return result, err
+	}
+	funcReturn, err = b.decrypt(funcReturn, result.Id)
+	if err != nil {
+		return result, err
+	}
+	result.FuncReturn = funcReturn
+	return result, nil
 }
 
 // AbortTask - exTime : 过期时间，秒
-func (b *ServerUtils) AbortTask(id string, expireTime int) error {
+// 中止的原因保存在Err中，backend支持时同时推送给server，中止正在运行的任务
+func (b *ServerUtils) AbortTask(id string, expireTime int, reason string) error {
 	if b.backend == nil {
 		return ierrors.ErrNilBackend{}
 	}
-	return b.backend.SetResult(message.NewAbortResult(id), expireTime)
+	result := message.NewAbortResult(id)
+	result.Err = reason
+	if err := b.backend.SetResult(result, expireTime); err != nil {
+		return err
+	}
+	if ab, ok := b.backend.(backends.AbortBackendInterface); ok {
+		// 推送失败时由server的定时检查中止任务
+		if err := ab.PublishAbort(id, reason); err != nil {
+			b.logger.Warn(fmt.Sprintf("publish abort signal of task [id=%s] error: %s", id, err))
+		}
+	}
+	return nil
 }
 
 func (b *ServerUtils) IsAbort(id string) (bool, error) {
+	isAbort, _, err := b.GetAbort(id)
+	return isAbort, err
+}
+
+// GetAbort return: whether the task is aborted, reason
+func (b *ServerUtils) GetAbort(id string) (bool, string, error) {
 	if b.backend == nil {
-		return false, ierrors.ErrNilBackend{}
+		return false, "", ierrors.ErrNilBackend{}
 	}
-	_, err := b.backend.GetResult(message.NewAbortResult(id).GetBackendKey())
+	result, err := b.backend.GetResult(message.NewAbortResult(id).GetBackendKey())
 	if err == nil {
-		return true, err
+		return true, result.Err, err
 	}
 	if ierrors.IsEqual(err, ierrors.ErrTypeNilResult) {
-		return false, nil
+		return false, "", nil
 	}
-	return false, err
+	return false, "", err
 }
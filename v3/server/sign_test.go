@@ -0,0 +1,51 @@
+package server
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eopenio/itask/v3/config"
+	"github.com/eopenio/itask/v3/message"
+	"github.com/eopenio/itask/v3/util/envelope"
+)
+
+func TestVerifySignatureReject(t *testing.T) {
+	keys := envelope.NewStaticKeyProvider("k1", map[string][]byte{"k1": []byte("0123456789abcdef")})
+	s := newMemoryServer(config.Signature(keys), config.VerifySignature(config.SignatureVerifyMode.Reject))
+	var mu sync.Mutex
+	var runs []int
+	s.Add("g", "w", func(n int) {
+		mu.Lock()
+		runs = append(runs, n)
+		mu.Unlock()
+	})
+	s.Run("g", 1)
+	defer shutdown(t, s)
+	c := s.GetClient()
+
+	// 直接写入队列的消息没有签名
+	forged := message.NewMessage(message.NewMsgArgs())
+	forged.WorkerName = "w"
+	forged.SetArgs(1)
+	if err := s.config.Broker.Send(c.sUtils.GetQueueName("g"), forged); err != nil {
+		t.Fatalf("Send() to the queue error = %v", err)
+	}
+	id, err := c.Send("g", "w", 2)
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	r, err := c.GetResult(id, 5*time.Second, 20*time.Millisecond)
+	if err != nil || r.Status != message.ResultStatus.Success {
+		t.Fatalf("signed task: GetResult() = %d, %v", r.Status, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(runs) != 1 || runs[0] != 2 {
+		t.Errorf("worker runs with %v, want only the signed task [2]", runs)
+	}
+	if r, err = c.sUtils.GetResult(forged.Id); err == nil {
+		t.Errorf("unsigned task has a result with status %d", r.Status)
+	}
+}
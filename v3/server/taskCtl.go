@@ -1,9 +1,11 @@
 package server
 
 import (
+	"context"
 	"errors"
 	"github.com/eopenio/itask/v3/ierrors"
 	"github.com/eopenio/itask/v3/message"
+	"sync"
 	"time"
 )
 
@@ -38,6 +40,61 @@ type TaskCtl struct {
 	message.Message
 	err error
 	su  *ServerUtils
+	run *taskRun
+}
+
+// taskRun 运行中的任务的context，TaskCtl被复制时共享
+type taskRun struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	timer  *time.Timer
+	mu     sync.Mutex
+	cause  error
+	busy   int      // Run返回后仍在运行的函数数量
+	idle   []func() // 这些函数都返回后调用
+}
+
+func (r *taskRun) cancelWith(cause error) {
+	r.mu.Lock()
+	if r.cause == nil {
+		r.cause = cause
+	}
+	r.mu.Unlock()
+	r.cancel()
+}
+
+// hold 标记一个可能在Run返回后继续运行的函数，函数返回时调用返回的done
+func (r *taskRun) hold() (done func()) {
+	r.mu.Lock()
+	r.busy++
+	r.mu.Unlock()
+	return func() {
+		r.mu.Lock()
+		r.busy--
+		var fs []func()
+		if r.busy == 0 {
+			fs, r.idle = r.idle, nil
+		}
+		r.mu.Unlock()
+		for _, f := range fs {
+			f()
+		}
+	}
+}
+
+// whenIdle 返回的函数在没有hold的函数运行时立即调用f，否则等它们都返回后再调用，
+// 用于任务被取消后仍然保留锁和并发名额，直到函数真正返回
+func (r *taskRun) whenIdle(f func()) func() {
+	return func() {
+		r.mu.Lock()
+		if r.busy > 0 {
+			r.idle = append(r.idle, f)
+			r.mu.Unlock()
+			return
+		}
+		r.mu.Unlock()
+		f()
+	}
 }
 
 func NewTaskCtl(msg message.Message) TaskCtl {
@@ -106,3 +163,75 @@ func (t *TaskCtl) IsAbort() (bool, error) {
 func (t *TaskCtl) SetServerUtil(su *ServerUtils) {
 	t.su = su
 }
+
+// Context
+// cancelled when the task times out, is aborted or the server shuts down, see CancelCause.
+// Worker funcs can also get it as the first param: func(ctx context.Context, ...)
+func (t *TaskCtl) Context() context.Context {
+	if t.run == nil {
+		return context.Background()
+	}
+	return t.run.ctx
+}
+
+// CancelCause why Context is cancelled, nil if it isn't:
+// ierrors.ErrTaskTimeout, ierrors.ErrAbortTask or ierrors.ErrServerStop
+func (t *TaskCtl) CancelCause() error {
+	if t.run == nil {
+		return nil
+	}
+	t.run.mu.Lock()
+	defer t.run.mu.Unlock()
+	if t.run.cause == nil && t.run.ctx.Err() != nil {
+		// 只有server停止时才会取消parent
+		return ierrors.ErrServerStop{}
+	}
+	return t.run.cause
+}
+
+// startContext 返回的函数取消context并停止计时
+func (t *TaskCtl) startContext(parent context.Context) func() {
+	ctx, cancel := context.WithCancel(parent)
+	r := &taskRun{ctx: ctx, cancel: cancel}
+	t.run = r
+	return func() {
+		r.mu.Lock()
+		if r.timer != nil {
+			r.timer.Stop()
+		}
+		r.mu.Unlock()
+		cancel()
+	}
+}
+
+// hold 见 taskRun.hold
+func (t *TaskCtl) hold() (done func()) {
+	if t.run == nil {
+		return func() {}
+	}
+	return t.run.hold()
+}
+
+// whenIdle 见 taskRun.whenIdle
+func (t *TaskCtl) whenIdle(f func()) func() {
+	if t.run == nil {
+		return f
+	}
+	return t.run.whenIdle(f)
+}
+
+// startTimeout 从现在开始计时，超时后取消context
+func (t *TaskCtl) startTimeout(d time.Duration) {
+	if t.run == nil || d <= 0 {
+		return
+	}
+	r := t.run
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	r.timer = time.AfterFunc(d, func() {
+		r.cancelWith(ierrors.ErrTaskTimeout{Timeout: d})
+	})
+}
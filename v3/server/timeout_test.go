@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/eopenio/itask/v3/ierrors"
+	"github.com/eopenio/itask/v3/message"
+)
+
+func TestTimeout(t *testing.T) {
+	s := newMemoryServer()
+	causes := make(chan error, 1)
+	s.Add("g", "wait", func(ctl *TaskCtl) {
+		<-ctl.Context().Done()
+		causes <- ctl.CancelCause()
+	}, Timeout(100*time.Millisecond))
+	// 不检查context的func，server不再等待它
+	s.Add("g", "ignore", func(ctx context.Context) {
+		time.Sleep(2 * time.Second)
+	})
+	s.Run("g", 2)
+	defer shutdown(t, s)
+	client := s.GetClient()
+	c := client.SetTaskCtl(client.RetryCount, 0)
+
+	id, err := c.Send("g", "wait")
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	r, err := c.GetResult(id, 5*time.Second, 20*time.Millisecond)
+	if err != nil || r.Status != message.ResultStatus.Timeout {
+		t.Fatalf("GetResult() = %d, %v, want status %d", r.Status, err, message.ResultStatus.Timeout)
+	}
+	if cause := <-causes; !ierrors.IsEqual(cause, ierrors.ErrTypeTaskTimeout) {
+		t.Errorf("CancelCause() = %v, want ErrTaskTimeout", cause)
+	}
+
+	start := time.Now()
+	id, err = c.SetTaskCtl(c.Timeout, 100*time.Millisecond).Send("g", "ignore")
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	r, err = c.GetResult(id, 5*time.Second, 20*time.Millisecond)
+	if err != nil || r.Status != message.ResultStatus.Timeout {
+		t.Fatalf("GetResult() with ctlKey.Timeout = %d, %v, want status %d", r.Status, err, message.ResultStatus.Timeout)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("task times out after %s, want 100ms", d)
+	}
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eopenio/itask/v3/message"
+)
+
+func TestSendUnique(t *testing.T) {
+	s := newMemoryServer()
+	var runs int32
+	s.Add("g", "w", func() { atomic.AddInt32(&runs, 1) })
+	s.Run("g", 1)
+	defer shutdown(t, s)
+	c := s.GetClient()
+
+	first, err := c.SendUnique("order-1", time.Second, "g", "w")
+	if err != nil {
+		t.Fatalf("SendUnique() error = %v", err)
+	}
+	if id, err := c.SendUnique("order-1", time.Second, "g", "w"); id != first || err != nil {
+		t.Fatalf("SendUnique() with the same key = %s, %v, want %s", id, err, first)
+	}
+	other, err := c.SendUnique("order-2", time.Second, "g", "w")
+	if err != nil || other == first {
+		t.Fatalf("SendUnique() with another key = %s, %v, want a new task", other, err)
+	}
+	for _, id := range []string{first, other} {
+		if r, err := c.GetResult(id, 5*time.Second, 20*time.Millisecond); err != nil || r.Status != message.ResultStatus.Success {
+			t.Fatalf("task %s: GetResult() = %d, %v", id, r.Status, err)
+		}
+	}
+	if n := atomic.LoadInt32(&runs); n != 2 {
+		t.Errorf("%d runs, want 2", n)
+	}
+
+	// window过后同一个key可以再次发送
+	time.Sleep(1100 * time.Millisecond)
+	if id, err := c.SendUnique("order-1", time.Second, "g", "w"); err != nil || id == first {
+		t.Errorf("SendUnique() after the window = %s, %v, want a new task", id, err)
+	}
+}
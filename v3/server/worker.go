@@ -1,11 +1,14 @@
 package server
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"github.com/eopenio/itask/v3/ierrors"
 	"github.com/eopenio/itask/v3/log"
 	"github.com/eopenio/itask/v3/message"
 	"github.com/eopenio/itask/v3/util"
+	"github.com/eopenio/itask/v3/util/codec"
 	"reflect"
 )
 
@@ -22,8 +25,37 @@ type FuncWorker struct {
 	Logger       log.LoggerInterface
 }
 
+// Run
+// the func runs in another goroutine, Run returns CancelCause when the context of the task is cancelled,
+// without waiting for the func. The func works on copies of ctl and result, so it can't change them after that,
+// and the server keeps the locks and the concurrency slot of the task until the func returns
 func (f *FuncWorker) Run(ctl *TaskCtl, funcArgs []string, result *message.Result) error {
-	return runFunc(f.Func, ctl, funcArgs, result, false, f.Logger)
+	ctx := ctl.Context()
+	if ctx.Done() == nil {
+		return runFunc(f.Func, ctl, funcArgs, result, false, f.Logger)
+	}
+	if ctx.Err() != nil {
+		return ctl.CancelCause()
+	}
+	c, r := *ctl, *result
+	done := make(chan error, 1)
+	finish := ctl.hold()
+	go func() {
+		err := runFunc(f.Func, &c, funcArgs, &r, false, f.Logger)
+		finish()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		*ctl, *result = c, r
+		// func因为context取消而返回时，使用取消的原因
+		if cause := ctl.CancelCause(); err != nil && cause != nil {
+			err = cause
+		}
+		return err
+	case <-ctx.Done():
+		return ctl.CancelCause()
+	}
 }
 
 func (f *FuncWorker) After(ctl *TaskCtl, funcArgs []string, result *message.Result) error {
@@ -38,6 +70,8 @@ func (f *FuncWorker) WorkerName() string {
 	return f.Name
 }
 
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
 // isCallBack: 是否是回调函数
 func runFunc(f interface{}, ctl *TaskCtl, funcArgs []string, result *message.Result, isCallBack bool, logger log.LoggerInterface) (err error) {
 	defer func() {
@@ -59,18 +93,28 @@ func runFunc(f interface{}, ctl *TaskCtl, funcArgs []string, result *message.Res
 	funcType := reflect.TypeOf(f)
 	var inStart = 0
 	var inValue []reflect.Value
-	if funcType.NumIn() > 0 && funcType.In(0) == reflect.TypeOf(&TaskCtl{}) {
-		inStart = 1
+	var firstArg reflect.Value
+	if funcType.NumIn() > 0 {
+		switch funcType.In(0) {
+		case reflect.TypeOf(&TaskCtl{}):
+			firstArg = reflect.ValueOf(ctl)
+			inStart = 1
+		case contextType:
+			firstArg = reflect.ValueOf(ctl.Context())
+			inStart = 1
+		}
 	}
 
 	inValue, err = util.GetCallInArgs(funcValue, funcArgs, inStart)
 	if err != nil {
+		// 参数不对时重试也不会成功
+		err = ierrors.Permanent(err)
 		return
 	}
 	if inStart == 1 {
 		inValue = append(inValue, reflect.Value{})
 		copy(inValue[1:], inValue)
-		inValue[0] = reflect.ValueOf(ctl)
+		inValue[0] = firstArg
 	}
 
 	if isCallBack {
@@ -87,7 +131,12 @@ func runFunc(f interface{}, ctl *TaskCtl, funcArgs []string, result *message.Res
 	if err == nil {
 		result.Status = message.ResultStatus.Success
 		if len(funcOut) > 0 {
-			re, err2 := util.GoValuesToTaskJsonSlice(funcOut)
+			// 结果与参数使用同一个codec
+			c, err2 := codec.Get(ctl.Codec)
+			var re []string
+			if err2 == nil {
+				re, err2 = util.GoValuesToCodecSlice(c, funcOut)
+			}
 			if err2 != nil {
 				//log.TaskLog.Error(err2)
 				logger.Error(err2.Error())
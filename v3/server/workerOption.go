@@ -0,0 +1,188 @@
+package server
+
+import (
+	"github.com/eopenio/itask/v3/message"
+	"math"
+	"time"
+)
+
+// WorkerOption
+// options of a worker, passed to Server.Add after the callback func
+type WorkerOption interface {
+	apply(*workerOptions)
+}
+
+type workerOptions struct {
+	lock        *LockOptions
+	rateLimit   *RateLimit
+	concurrency *concurrencyLimit
+	backoff     *message.RetryBackoff
+	retryable   Retryable
+	timeout     time.Duration
+}
+
+// delayedOption 需要延时服务重新投递任务的option，没有时返回空字符串
+func (o workerOptions) delayedOption() string {
+	switch {
+	case o.backoff != nil:
+		return "RetryBackoff"
+	case o.lock != nil && o.lock.OnBusy == LockBusyPolicy.Reschedule:
+		return "LockOptions with LockBusyPolicy.Reschedule"
+	case o.rateLimit != nil:
+		return "RateLimit"
+	case o.concurrency != nil:
+		return "Concurrency"
+	}
+	return ""
+}
+
+// splitWorkerOptions 从callbackFunc中分离出WorkerOption
+func splitWorkerOptions(args []interface{}) ([]interface{}, workerOptions) {
+	var opts workerOptions
+	var funcs = make([]interface{}, 0, len(args))
+	for _, arg := range args {
+		if o, ok := arg.(WorkerOption); ok {
+			o.apply(&opts)
+			continue
+		}
+		funcs = append(funcs, arg)
+	}
+	return funcs, opts
+}
+
+type lockBusyPolicyChoice struct {
+	Reschedule int
+	Fail       int
+}
+
+// LockBusyPolicy
+// what a task does when one of its locks is held by another task.
+// Reschedule sends the task to the delay queue of the group, which is only consumed when Config.EnableDelayServer is set:
+// the delay server keeps the delayed messages itself, or moves the due ones of a broker that supports delayed messages.
+// Without it rescheduled tasks stay in the delay queue and never run.
+// RateLimit, Concurrency and RetryBackoff use the delay queue in the same way.
+var LockBusyPolicy = lockBusyPolicyChoice{
+	Reschedule: 0, // 放入延时队列，RetryAfter之后再运行
+	Fail:       1, // 任务直接失败
+}
+
+// LockOptions
+// the task runs only after all its locks are acquired from the backend (backends.LockBackendInterface),
+// locks are renewed while the task is running and released after it finished.
+// Names of the task are Names plus the names set by Client.SetTaskCtl(ctlKey.Locks, ...),
+// if both are empty the worker name is used, so the worker never runs concurrently (singleton).
+type LockOptions struct {
+	// "{i}" is replaced by the i-th arg of the task, e.g. "recompute:{0}"
+	Names []string
+	// default: 30s
+	TTL time.Duration
+	// default: LockBusyPolicy.Reschedule
+	OnBusy int
+	// default: 10s
+	RetryAfter time.Duration
+}
+
+func (o LockOptions) apply(opts *workerOptions) {
+	if o.TTL <= 0 {
+		o.TTL = 30 * time.Second
+	}
+	if o.RetryAfter <= 0 {
+		o.RetryAfter = 10 * time.Second
+	}
+	opts.lock = &o
+}
+
+// RateLimit
+// at most Rate tasks of the worker start per second across all servers of the group,
+// the token bucket is kept in the backend (backends.RateLimitBackendInterface).
+// Tasks over the limit are sent to the delay queue until a token is available,
+// it needs Config.EnableDelayServer, see LockBusyPolicy.
+type RateLimit struct {
+	// tokens per second
+	Rate float64
+	// default: ceil(Rate)
+	Burst int
+}
+
+func (o RateLimit) apply(opts *workerOptions) {
+	if o.Rate <= 0 {
+		panic("rate of RateLimit must be positive")
+	}
+	if o.Burst <= 0 {
+		o.Burst = int(math.Max(1, math.Ceil(o.Rate)))
+	}
+	opts.rateLimit = &o
+}
+
+// Concurrency
+// at most Max tasks of the worker run at the same time in this server,
+// with Global the limit is shared by all servers of the group: each running task holds one of Max slots
+// in the backend (backends.LockBackendInterface), slots are renewed while the task is running.
+// Tasks of a saturated worker are sent to the delay queue and tried again after RetryAfter,
+// so they don't block the messages of other workers.
+// it needs Config.EnableDelayServer, see LockBusyPolicy.
+type Concurrency struct {
+	Max    int
+	Global bool
+	// default: 30s, TTL of the global slots, a slot of a dead server is freed after it
+	TTL time.Duration
+	// default: 1s
+	RetryAfter time.Duration
+}
+
+// concurrencyLimit running: 当前server中正在运行的任务数
+type concurrencyLimit struct {
+	Concurrency
+	running *int32
+}
+
+func (o Concurrency) apply(opts *workerOptions) {
+	if o.Max <= 0 {
+		panic("max of Concurrency must be positive")
+	}
+	if o.TTL <= 0 {
+		o.TTL = 30 * time.Second
+	}
+	if o.RetryAfter <= 0 {
+		o.RetryAfter = time.Second
+	}
+	opts.concurrency = &concurrencyLimit{Concurrency: o, running: new(int32)}
+}
+
+// RetryBackoff
+// delay between retries of the worker, see message.RetryBackoff.
+// Retries are sent to the delay queue with the computed run time, so they don't hold the worker goroutine,
+// it needs Config.EnableDelayServer, see LockBusyPolicy.
+// Client.SetTaskCtl(ctlKey.Backoff, ...) overrides it for a task.
+// Without backoff failed tasks are sent back to the queue of the group at once.
+type RetryBackoff message.RetryBackoff
+
+func (o RetryBackoff) apply(opts *workerOptions) {
+	b := message.RetryBackoff(o)
+	opts.backoff = &b
+}
+
+// Retryable
+// decide whether a failed task of the worker retries, tasks that are not retryable fail at once.
+// ierrors.Permanent errors never retry and ierrors.RetryAfter errors always retry (while RetryCount > 0),
+// whatever Retryable returns
+//
+//	s.Add("group1", "charge", charge, server.Retryable(func(err error) bool {
+//		return !errors.Is(err, ErrCardDeclined)
+//	}))
+type Retryable func(err error) bool
+
+func (o Retryable) apply(opts *workerOptions) {
+	opts.retryable = o
+}
+
+// Timeout
+// timeout of each run of the worker, Client.SetTaskCtl(ctlKey.Timeout, ...) overrides it for a task.
+// The context of the task (TaskCtl.Context) is cancelled on timeout and the server stops waiting for the func,
+// the task retries like other errors, it finishes with status Timeout if it can't.
+// Go can't stop a goroutine, funcs should return when the context is done.
+type Timeout time.Duration
+
+func (o Timeout) apply(opts *workerOptions) {
+	opts.timeout = time.Duration(o)
+}
@@ -2,10 +2,13 @@ package Task
 
 import (
 	"github.com/eopenio/itask/v3/backends"
+	"github.com/eopenio/itask/v3/blob"
 	"github.com/eopenio/itask/v3/brokers"
 	"github.com/eopenio/itask/v3/config"
 	"github.com/eopenio/itask/v3/log"
 	"github.com/eopenio/itask/v3/server"
+	"github.com/eopenio/itask/v3/util/codec"
+	"github.com/eopenio/itask/v3/util/envelope"
 )
 
 var (
@@ -56,6 +59,68 @@ func (i iConfig) ResultExpires(expireTime int) config.SetConfigFunc {
 	return config.ResultExpires(expireTime)
 }
 
+// VisibilityTimeout default: 5 min
+// un-acked messages are delivered again after ex seconds, only used by brokers.AckBrokerInterface
+func (i iConfig) VisibilityTimeout(ex int) config.SetConfigFunc {
+	return config.VisibilityTimeout(ex)
+}
+
+// EnableDeadLetter default: false
+// copy the message to the dead letter queue when the task finished with one of status (default: Failure, Timeout)
+func (i iConfig) EnableDeadLetter(enable bool, status ...int) config.SetConfigFunc {
+	return config.EnableDeadLetter(enable, status...)
+}
+
+// Priority default: 1 level, aging disabled
+// task priority is in [0, levels-1], higher priority tasks run first
+// a lower priority queue is checked first after being passed over aging times
+func (i iConfig) Priority(levels int, aging int) config.SetConfigFunc {
+	return config.Priority(levels, aging)
+}
+
+// Prefetch default: disabled
+// take count messages from the broker at once for groupNames (all groups if empty),
+// prefetched messages that have not started are sent back on shutdown
+func (i iConfig) Prefetch(count int, groupNames ...string) config.SetConfigFunc {
+	return config.Prefetch(count, groupNames...)
+}
+
+// Encryption default: disabled
+// encrypt task args on Send and results on SetResult, all clients and servers need the same keys
+func (i iConfig) Encryption(p envelope.KeyProvider) config.SetConfigFunc {
+	return config.Encryption(p)
+}
+
+// Signature default: disabled
+// sign messages with HMAC, servers verify them according to VerifySignature
+func (i iConfig) Signature(p envelope.KeyProvider) config.SetConfigFunc {
+	return config.Signature(p)
+}
+
+// VerifySignature default: config.SignatureVerifyMode.None
+// what servers of groupNames (all groups if empty) do with unsigned or tampered messages
+func (i iConfig) VerifySignature(mode int, groupNames ...string) config.SetConfigFunc {
+	return config.VerifySignature(mode, groupNames...)
+}
+
+// Codec default: codec.JSON
+// codec of task args, messages sent with different codecs can be run by the same servers
+func (i iConfig) Codec(c codec.Codec) config.SetConfigFunc {
+	return config.Codec(c)
+}
+
+// ClaimCheck default: disabled
+// save args and results longer than threshold bytes in store, all clients and servers need the same store
+func (i iConfig) ClaimCheck(store blob.StoreInterface, threshold int) config.SetConfigFunc {
+	return config.ClaimCheck(store, threshold)
+}
+
+// AbortCheckInterval default: 1s
+// how often servers check whether running tasks are aborted, in seconds, <=0:disabled
+func (i iConfig) AbortCheckInterval(ex int) config.SetConfigFunc {
+	return config.AbortCheckInterval(ex)
+}
+
 type iLogger struct{}
 
 func (i iLogger) NewTaskLogger() log.LoggerInterface {
@@ -0,0 +1,187 @@
+package codec
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/eopenio/itask/v3/util/yjson"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	JSONName     = "json"
+	MsgPackName  = "msgpack"
+	ProtobufName = "protobuf"
+)
+
+var ErrNotProtoMessage = errors.New("Task: value is not a proto.Message")
+
+// Codec
+// encode task args and results, registered codecs are found by Name,
+// so a server can decode values sent by clients using another codec
+type Codec interface {
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(b []byte, v interface{}) error
+}
+
+var (
+	JSON     Codec = jsonCodec{}
+	MsgPack  Codec = msgpackCodec{}
+	Protobuf Codec = protobufCodec{}
+)
+
+var registry = sync.Map{} // [name]Codec
+
+func init() {
+	Register(JSON)
+	Register(MsgPack)
+	Register(Protobuf)
+}
+
+// Register 注册自定义codec，同名的会被覆盖
+func Register(c Codec) {
+	registry.Store(c.Name(), c)
+}
+
+func Get(name string) (Codec, error) {
+	if name == "" {
+		return JSON, nil
+	}
+	c, ok := registry.Load(name)
+	if !ok {
+		return nil, fmt.Errorf("Task: codec [%s] is not registered", name)
+	}
+	return c.(Codec), nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return JSONName
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return yjson.TaskJson.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(b []byte, v interface{}) error {
+	return yjson.TaskJson.Unmarshal(b, v)
+}
+
+// msgpackCodec 编码结果比json紧凑，但放入消息时仍要base64，见 Encode
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string {
+	return MsgPackName
+}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (msgpackCodec) Unmarshal(b []byte, v interface{}) error {
+	return msgpack.Unmarshal(b, v)
+}
+
+// protobufCodec 只能编码proto.Message，其它值由Encode改用JSON
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string {
+	return ProtobufName
+}
+
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, ErrNotProtoMessage
+	}
+	return proto.Marshal(m)
+}
+
+// Unmarshal v: proto.Message, or pointer to a nil *T (e.g. worker func arg) that implements proto.Message
+func (protobufCodec) Unmarshal(b []byte, v interface{}) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(b, m)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Ptr {
+		return ErrNotProtoMessage
+	}
+	elem := reflect.New(rv.Elem().Type().Elem())
+	m, ok := elem.Interface().(proto.Message)
+	if !ok {
+		return ErrNotProtoMessage
+	}
+	if err := proto.Unmarshal(b, m); err != nil {
+		return err
+	}
+	rv.Elem().Set(elem)
+	return nil
+}
+
+// 非JSON编码的值以 !<codec name>: 开头，后面是base64，json不会以!开头，所以旧数据可以直接读取
+const prefix = "!"
+
+// Encode
+// JSON values are kept as is, values of other codecs are prefixed with the codec name,
+// so the value can be decoded without knowing which codec the sender used.
+// The message itself is JSON, so binary values of other codecs are base64 encoded and take about 4/3 of their size
+func Encode(c Codec, v interface{}) (string, error) {
+	if c == nil || c.Name() == JSONName {
+		b, err := JSON.Marshal(v)
+		return string(b), err
+	}
+	b, err := c.Marshal(v)
+	if err == ErrNotProtoMessage {
+		return Encode(JSON, v)
+	}
+	if err != nil {
+		return "", err
+	}
+	return prefix + c.Name() + ":" + base64.StdEncoding.EncodeToString(b), nil
+}
+
+func EncodeSlice(c Codec, args ...interface{}) ([]string, error) {
+	var r = make([]string, len(args))
+	for i, v := range args {
+		s, err := Encode(c, v)
+		if err != nil {
+			return r, err
+		}
+		r[i] = s
+	}
+	return r, nil
+}
+
+// Decode 根据前缀选择codec
+func Decode(s string, v interface{}) error {
+	name, data := Split(s)
+	c, err := Get(name)
+	if err != nil {
+		return err
+	}
+	if name == JSONName {
+		return c.Unmarshal([]byte(data), v)
+	}
+	b, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return err
+	}
+	return c.Unmarshal(b, v)
+}
+
+// Split return the codec name and the encoded data of s
+func Split(s string) (string, string) {
+	if strings.HasPrefix(s, prefix) {
+		if i := strings.IndexByte(s, ':'); i > len(prefix) {
+			return s[len(prefix):i], s[i+1:]
+		}
+	}
+	return JSONName, s
+}
@@ -0,0 +1,103 @@
+package codec
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	tests := []struct {
+		name   string
+		codec  Codec
+		value  interface{}
+		prefix string
+	}{
+		{"json int", JSON, 42, ""},
+		{"json string", JSON, "hi", ""},
+		{"json map", JSON, map[string]int{"a": 1}, ""},
+		{"nil codec", nil, []string{"a", "b"}, ""},
+		{"msgpack int", MsgPack, 42, "!msgpack:"},
+		{"msgpack string", MsgPack, "hi", "!msgpack:"},
+		{"msgpack bytes", MsgPack, []byte{0, 1, 2, 255}, "!msgpack:"},
+		{"msgpack map", MsgPack, map[string]int{"a": 1}, "!msgpack:"},
+		{"protobuf falls back to json", Protobuf, 42, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Encode(tt.codec, tt.value)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			if tt.prefix != "" && !strings.HasPrefix(s, tt.prefix) || tt.prefix == "" && strings.HasPrefix(s, prefix) {
+				t.Errorf("Encode() = %q, want prefix %q", s, tt.prefix)
+			}
+			got := reflect.New(reflect.TypeOf(tt.value))
+			if err = Decode(s, got.Interface()); err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Elem().Interface(), tt.value) {
+				t.Errorf("Decode() = %v, want %v", got.Elem().Interface(), tt.value)
+			}
+		})
+	}
+}
+
+func TestEncodeDecodeProtobuf(t *testing.T) {
+	s, err := Encode(Protobuf, wrapperspb.String("hi"))
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if !strings.HasPrefix(s, "!protobuf:") {
+		t.Errorf("Encode() = %q, want prefix !protobuf:", s)
+	}
+	// worker函数的参数是nil指针
+	var got *wrapperspb.StringValue
+	if err = Decode(s, &got); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if got.GetValue() != "hi" {
+		t.Errorf("Decode() = %v, want hi", got)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+	}{
+		{"unregistered codec", "!unknown:AAAA"},
+		{"bad base64", "!msgpack:%%%"},
+		{"bad json", "{"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v interface{}
+			if err := Decode(tt.s, &v); err == nil {
+				t.Errorf("Decode(%q) error = nil, want error", tt.s)
+			}
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		s    string
+		name string
+		data string
+	}{
+		{`{"a":1}`, JSONName, `{"a":1}`},
+		{`"!msgpack:x"`, JSONName, `"!msgpack:x"`},
+		{"!msgpack:AAE=", MsgPackName, "AAE="},
+		{"!:AAE=", JSONName, "!:AAE="},
+		{"!nocolon", JSONName, "!nocolon"},
+	}
+	for _, tt := range tests {
+		name, data := Split(tt.s)
+		if name != tt.name || data != tt.data {
+			t.Errorf("Split(%q) = (%q, %q), want (%q, %q)", tt.s, name, data, tt.name, tt.data)
+		}
+	}
+}
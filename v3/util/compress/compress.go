@@ -0,0 +1,123 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/eopenio/itask/v3/util/yjson"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	None = 0
+	Gzip = 1
+	Zstd = 2
+)
+
+// 压缩后的数据以 magic + 算法 开头，json不会以0x00开头，所以未压缩的旧数据可以直接读取
+var magic = []byte{0x00, 'I', 'Z'}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+)
+
+func initZstd() {
+	zstdOnce.Do(func() {
+		zstdEncoder, _ = zstd.NewWriter(nil)
+		zstdDecoder, _ = zstd.NewReader(nil)
+	})
+}
+
+// Compressor
+// compress payloads not shorter than Threshold bytes with Algorithm,
+// the zero value doesn't compress
+type Compressor struct {
+	Algorithm int
+	Threshold int
+}
+
+func NewCompressor(algorithm int, threshold int) Compressor {
+	return Compressor{Algorithm: algorithm, Threshold: threshold}
+}
+
+// Compress 压缩后没有变小时返回原数据
+func (c Compressor) Compress(b []byte) ([]byte, error) {
+	if c.Algorithm == None || len(b) < c.Threshold {
+		return b, nil
+	}
+	var buf bytes.Buffer
+	buf.Write(magic)
+	buf.WriteByte(byte(c.Algorithm))
+	switch c.Algorithm {
+	case Gzip:
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(b); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	case Zstd:
+		initZstd()
+		buf.Write(zstdEncoder.EncodeAll(b, nil))
+	default:
+		return nil, fmt.Errorf("Task: unknown compression algorithm %d", c.Algorithm)
+	}
+	if buf.Len() >= len(b) {
+		return b, nil
+	}
+	return buf.Bytes(), nil
+}
+
+func IsCompressed(b []byte) bool {
+	return len(b) > len(magic) && bytes.HasPrefix(b, magic)
+}
+
+// Decompress 未压缩的数据原样返回
+func Decompress(b []byte) ([]byte, error) {
+	if !IsCompressed(b) {
+		return b, nil
+	}
+	algorithm, data := int(b[len(magic)]), b[len(magic)+1:]
+	switch algorithm {
+	case Gzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	case Zstd:
+		initZstd()
+		return zstdDecoder.DecodeAll(data, nil)
+	default:
+		return nil, fmt.Errorf("Task: unknown compression algorithm %d", algorithm)
+	}
+}
+
+// Marshal yjson.TaskJson.Marshal then Compress
+func (c Compressor) Marshal(v interface{}) ([]byte, error) {
+	b, err := yjson.TaskJson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return c.Compress(b)
+}
+
+// Unmarshal Decompress then yjson.TaskJson.Unmarshal
+func Unmarshal(b []byte, v interface{}) error {
+	b, err := Decompress(b)
+	if err != nil {
+		return err
+	}
+	return yjson.TaskJson.Unmarshal(b, v)
+}
+
+func UnmarshalFromString(s string, v interface{}) error {
+	return Unmarshal([]byte(s), v)
+}
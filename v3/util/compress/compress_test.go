@@ -0,0 +1,55 @@
+package compress
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/eopenio/itask/v3/message"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	large := bytes.Repeat([]byte(`{"k":"value"}`), 100)
+	for _, algorithm := range []int{Gzip, Zstd} {
+		c := NewCompressor(algorithm, 64)
+		b, err := c.Compress(large)
+		if err != nil {
+			t.Fatalf("Compress() with algorithm %d error = %v", algorithm, err)
+		}
+		if !IsCompressed(b) || len(b) >= len(large) {
+			t.Errorf("Compress() with algorithm %d returns %d bytes, want compressed", algorithm, len(b))
+		}
+		got, err := Decompress(b)
+		if err != nil || !bytes.Equal(got, large) {
+			t.Errorf("Decompress() with algorithm %d = %d bytes, %v, want the input", algorithm, len(got), err)
+		}
+
+		// 小于阈值的数据不压缩
+		small := []byte(`{"k":"v"}`)
+		if b, _ = c.Compress(small); !bytes.Equal(b, small) {
+			t.Errorf("Compress() below the threshold = %q, want %q", b, small)
+		}
+	}
+}
+
+// 未压缩的旧消息和压缩后的消息都能读取
+func TestUnmarshalLegacy(t *testing.T) {
+	msg := message.NewMessage(message.NewMsgArgs())
+	msg.WorkerName = "w"
+	plain, err := Compressor{}.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := NewCompressor(Gzip, 0).Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsCompressed(plain) || !IsCompressed(compressed) {
+		t.Fatalf("IsCompressed() = %t, %t, want false, true", IsCompressed(plain), IsCompressed(compressed))
+	}
+	for _, b := range [][]byte{plain, compressed} {
+		var got message.Message
+		if err = UnmarshalFromString(string(b), &got); err != nil || got.Id != msg.Id || got.WorkerName != "w" {
+			t.Errorf("Unmarshal() = %s %s, %v, want %s w", got.Id, got.WorkerName, err, msg.Id)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/eopenio/itask/v3/util/yjson"
+)
+
+// 加密后的数据以prefix开头，json编码的参数不会以!开头
+const prefix = "!enc:"
+
+// KeyProvider
+// master keys (16, 24 or 32 bytes for AES-128/192/256) used to encrypt the data keys.
+// After rotation keep the old keys in GetKey, so data encrypted with them is still readable.
+type KeyProvider interface {
+	// CurrentKeyId id of the key used to encrypt new data
+	CurrentKeyId() string
+	GetKey(keyId string) ([]byte, error)
+}
+
+// StaticKeyProvider keys are kept in memory
+type StaticKeyProvider struct {
+	currentKeyId string
+	keys         map[string][]byte
+}
+
+func NewStaticKeyProvider(currentKeyId string, keys map[string][]byte) StaticKeyProvider {
+	return StaticKeyProvider{currentKeyId: currentKeyId, keys: keys}
+}
+
+func (p StaticKeyProvider) CurrentKeyId() string {
+	return p.currentKeyId
+}
+
+func (p StaticKeyProvider) GetKey(keyId string) ([]byte, error) {
+	key, ok := p.keys[keyId]
+	if !ok {
+		return nil, fmt.Errorf("encryption key [%s] not found", keyId)
+	}
+	return key, nil
+}
+
+type sealed struct {
+	KeyId   string
+	DataKey []byte // 用KeyId对应的key加密后的数据密钥
+	Data    []byte // 用数据密钥加密后的数据
+}
+
+// Encryptor
+// envelope encryption with AES-GCM: every payload is encrypted with a new random data key,
+// the data key is encrypted with the current key of the provider and stored with the payload
+type Encryptor struct {
+	provider KeyProvider
+}
+
+func NewEncryptor(p KeyProvider) Encryptor {
+	return Encryptor{provider: p}
+}
+
+// Encrypt
+//   - aad: additional data bound to the ciphertext (e.g. task id), the same aad is required by Decrypt
+func (e Encryptor) Encrypt(plaintext []byte, aad string) (string, error) {
+	keyId := e.provider.CurrentKeyId()
+	key, err := e.provider.GetKey(keyId)
+	if err != nil {
+		return "", err
+	}
+	dataKey := make([]byte, 32)
+	if _, err = rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	s := sealed{KeyId: keyId}
+	if s.DataKey, err = seal(key, dataKey, []byte(keyId)); err != nil {
+		return "", err
+	}
+	if s.Data, err = seal(dataKey, plaintext, []byte(aad)); err != nil {
+		return "", err
+	}
+	b, err := yjson.TaskJson.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	return prefix + base64.StdEncoding.EncodeToString(b), nil
+}
+
+func (e Encryptor) Decrypt(ciphertext string, aad string) ([]byte, error) {
+	if !IsEncrypted(ciphertext) {
+		return nil, errors.New("data is not encrypted")
+	}
+	b, err := base64.StdEncoding.DecodeString(ciphertext[len(prefix):])
+	if err != nil {
+		return nil, err
+	}
+	var s sealed
+	if err = yjson.TaskJson.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+	key, err := e.provider.GetKey(s.KeyId)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := open(key, s.DataKey, []byte(s.KeyId))
+	if err != nil {
+		return nil, err
+	}
+	return open(dataKey, s.Data, []byte(aad))
+}
+
+// EncryptSlice 整个slice加密为一个元素
+func (e Encryptor) EncryptSlice(values []string, aad string) ([]string, error) {
+	b, err := yjson.TaskJson.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	s, err := e.Encrypt(b, aad)
+	if err != nil {
+		return nil, err
+	}
+	return []string{s}, nil
+}
+
+// DecryptSlice 未加密的slice原样返回
+func (e Encryptor) DecryptSlice(values []string, aad string) ([]string, error) {
+	if !IsEncryptedSlice(values) {
+		return values, nil
+	}
+	b, err := e.Decrypt(values[0], aad)
+	if err != nil {
+		return nil, err
+	}
+	var r []string
+	err = yjson.TaskJson.Unmarshal(b, &r)
+	return r, err
+}
+
+func IsEncrypted(s string) bool {
+	return strings.HasPrefix(s, prefix)
+}
+
+func IsEncryptedSlice(values []string) bool {
+	return len(values) == 1 && IsEncrypted(values[0])
+}
+
+func seal(key []byte, plaintext []byte, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(key []byte, ciphertext []byte, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	nonce, data := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, data, aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
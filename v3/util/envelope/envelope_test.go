@@ -0,0 +1,77 @@
+package envelope
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+var (
+	key1 = bytes.Repeat([]byte{1}, 32)
+	key2 = bytes.Repeat([]byte{2}, 32)
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	e := NewEncryptor(NewStaticKeyProvider("k1", map[string][]byte{"k1": key1}))
+	s, err := e.Encrypt([]byte("secret"), "task-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(s) || bytes.Contains([]byte(s), []byte("secret")) {
+		t.Fatalf("Encrypt() = %q", s)
+	}
+	got, err := e.Decrypt(s, "task-1")
+	if err != nil || string(got) != "secret" {
+		t.Fatalf("Decrypt() = %q, %v", got, err)
+	}
+	// 密文与任务id绑定，不能挪到其它任务中使用
+	if _, err = e.Decrypt(s, "task-2"); err == nil {
+		t.Error("Decrypt() with another aad succeeded")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	old := NewEncryptor(NewStaticKeyProvider("k1", map[string][]byte{"k1": key1}))
+	s, err := old.Encrypt([]byte("secret"), "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := NewEncryptor(NewStaticKeyProvider("k2", map[string][]byte{"k1": key1, "k2": key2}))
+	if got, err := rotated.Decrypt(s, "id"); err != nil || string(got) != "secret" {
+		t.Errorf("Decrypt() of data encrypted with the old key = %q, %v", got, err)
+	}
+	s2, _ := rotated.Encrypt([]byte("secret"), "id")
+	if _, err = old.Decrypt(s2, "id"); err == nil {
+		t.Error("Decrypt() without the new key succeeded")
+	}
+
+	// 同一个key id对应了不同的key
+	wrong := NewEncryptor(NewStaticKeyProvider("k1", map[string][]byte{"k1": key2}))
+	if _, err = wrong.Decrypt(s, "id"); err == nil {
+		t.Error("Decrypt() with a wrong key succeeded")
+	}
+}
+
+func TestEncryptDecryptSlice(t *testing.T) {
+	e := NewEncryptor(NewStaticKeyProvider("k1", map[string][]byte{"k1": key1}))
+	for _, values := range [][]string{{}, {"1"}, {"1", `"a"`, `{"b":2}`}} {
+		enc, err := e.EncryptSlice(values, "id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsEncryptedSlice(enc) {
+			t.Errorf("IsEncryptedSlice(%q) = false", enc)
+		}
+		got, err := e.DecryptSlice(enc, "id")
+		if err != nil || !reflect.DeepEqual(got, values) {
+			t.Errorf("DecryptSlice() = %q, %v, want %q", got, err, values)
+		}
+	}
+
+	// 未加密的参数原样返回，兼容加密之前发送的消息
+	plain := []string{"1", "2"}
+	if got, err := e.DecryptSlice(plain, "id"); err != nil || !reflect.DeepEqual(got, plain) {
+		t.Errorf("DecryptSlice() = %q, %v, want %q", got, err, plain)
+	}
+}
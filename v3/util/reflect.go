@@ -1,6 +1,7 @@
 package util
 
 import (
+	"github.com/eopenio/itask/v3/util/codec"
 	"github.com/eopenio/itask/v3/util/yjson"
 	"reflect"
 )
@@ -23,9 +24,13 @@ func GoVarsToTaskJsonSlice(args ...interface{}) ([]string, error) {
 }
 
 func GoValuesToTaskJsonSlice(values []reflect.Value) ([]string, error) {
+	return GoValuesToCodecSlice(codec.JSON, values)
+}
+
+func GoValuesToCodecSlice(c codec.Codec, values []reflect.Value) ([]string, error) {
 	var r = make([]string, len(values))
 	for i, v := range values {
-		s, err := GoVarToTaskJson(v.Interface())
+		s, err := codec.Encode(c, v.Interface())
 		if err != nil {
 			return r, err
 		}
@@ -44,8 +49,8 @@ func GetCallInArgs(funcValue reflect.Value, funcArgs []string, inStart int) ([]r
 		}
 		inType := funcValue.Type().In(i)
 		inValue := reflect.New(inType)
-		// yjson to go value
-		err := yjson.TaskJson.Unmarshal([]byte(funcArgs[i-inStart]), inValue.Interface())
+		// yjson (or other codec) to go value
+		err := codec.Decode(funcArgs[i-inStart], inValue.Interface())
 
 		if err != nil {
 			return inArgs, err
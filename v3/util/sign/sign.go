@@ -0,0 +1,54 @@
+package sign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+
+	"github.com/eopenio/itask/v3/util/envelope"
+)
+
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// Signer
+// HMAC-SHA256 signatures, keys are got from the provider by key id,
+// keep the old keys after rotation so messages signed with them can still be verified
+type Signer struct {
+	provider envelope.KeyProvider
+}
+
+func NewSigner(p envelope.KeyProvider) Signer {
+	return Signer{provider: p}
+}
+
+// Sign 使用当前的key签名
+func (s Signer) Sign(data []byte) (keyId string, signature string, err error) {
+	keyId = s.provider.CurrentKeyId()
+	key, err := s.provider.GetKey(keyId)
+	if err != nil {
+		return "", "", err
+	}
+	return keyId, base64.StdEncoding.EncodeToString(sum(key, data)), nil
+}
+
+func (s Signer) Verify(keyId string, signature string, data []byte) error {
+	key, err := s.provider.GetKey(keyId)
+	if err != nil {
+		return err
+	}
+	b, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal(b, sum(key, data)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func sum(key []byte, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}